@@ -0,0 +1,242 @@
+// Package analytics records searches in search_log and reports on them.
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"movie-search-db/logging"
+)
+
+type Entry struct {
+	Time        time.Time
+	Query       string
+	Mode        string
+	Profile     string
+	Filters     any
+	ResultIDs   []int64
+	Total       int
+	TopScore    *float64
+	Latency     time.Duration
+	CacheHit    bool
+	ZeroResults bool
+	ClientHash  string
+	APIKeyID    *int
+}
+
+// HashClient turns a client identifier (IP address) into a salted hash so
+// the log can tell clients apart without storing who they are.
+func HashClient(salt, client string) string {
+	sum := sha256.Sum256([]byte(salt + "|" + client))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Salt returns the salt stored in search_log_salt. The first caller
+// stores a random one; concurrent callers all get the stored value.
+func Salt(ctx context.Context, db *sql.DB) (string, error) {
+	if _, err := db.ExecContext(ctx, `INSERT INTO search_log_salt (salt) VALUES ($1) ON CONFLICT DO NOTHING`,
+		rand.Text()); err != nil {
+		return "", err
+	}
+	var salt string
+	err := db.QueryRowContext(ctx, `SELECT salt FROM search_log_salt`).Scan(&salt)
+	return salt, err
+}
+
+// Logger writes entries in the background so logging never slows a
+// search down. When the buffer is full entries are dropped.
+type Logger struct {
+	db      *sql.DB
+	entries chan Entry
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewLogger(db *sql.DB, buffer int) *Logger {
+	l := &Logger{db: db, entries: make(chan Entry, buffer), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *Logger) Log(e Entry) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.entries <- e:
+	default:
+		slog.Warn("search log buffer full, entry dropped")
+	}
+}
+
+// Close flushes the buffered entries. Entries logged after Close are
+// dropped.
+func (l *Logger) Close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	const maxBatch = 100
+	batch := make([]Entry, 0, maxBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := insert(context.Background(), l.db, batch); err != nil {
+			slog.Error("search log write failed", "entries", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-l.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) == maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func insert(ctx context.Context, db *sql.DB, batch []Entry) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("search_log",
+		"created_at", "query", "mode", "profile", "filters", "result_ids", "total", "top_score",
+		"latency_ms", "cache_hit", "zero_results", "client_hash", "api_key_id"))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, e := range batch {
+		filters, _ := json.Marshal(e.Filters)
+		if _, err := stmt.ExecContext(ctx, e.Time, e.Query, e.Mode, e.Profile, string(filters),
+			pq.Array(e.ResultIDs), e.Total, e.TopScore, float64(e.Latency.Microseconds())/1000,
+			e.CacheHit, e.ZeroResults, e.ClientHash, e.APIKeyID); err != nil {
+			_ = stmt.Close()
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		_ = tx.Rollback()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Prune deletes entries older than retention.
+func Prune(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM search_log WHERE created_at < now() - make_interval(secs => $1)`,
+		retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type QueryCount struct {
+	Query       string  `json:"query"`
+	Count       int     `json:"count"`
+	AvgResults  float64 `json:"avgResults"`
+	AvgTopScore float64 `json:"avgTopScore"`
+}
+
+type Report struct {
+	Since         time.Time    `json:"since"`
+	Searches      int          `json:"searches"`
+	UniqueClients int          `json:"uniqueClients"`
+	ZeroResults   int          `json:"zeroResults"`
+	CacheHitRate  float64      `json:"cacheHitRate"`
+	AvgLatencyMs  float64      `json:"avgLatencyMs"`
+	P95LatencyMs  float64      `json:"p95LatencyMs"`
+	TopQueries    []QueryCount `json:"topQueries"`
+	ZeroQueries   []QueryCount `json:"zeroResultQueries"`
+}
+
+// BuildReport summarizes the searches of the last window.
+func BuildReport(ctx context.Context, db *sql.DB, window time.Duration, top int) (*Report, error) {
+	r := &Report{Since: time.Now().Add(-window).UTC()}
+
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+		       COUNT(DISTINCT client_hash),
+		       COUNT(*) FILTER (WHERE zero_results),
+		       COALESCE(AVG(cache_hit::int), 0),
+		       COALESCE(AVG(latency_ms), 0),
+		       COALESCE(PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY latency_ms), 0)
+		FROM search_log WHERE created_at >= $1`, r.Since).
+		Scan(&r.Searches, &r.UniqueClients, &r.ZeroResults, &r.CacheHitRate, &r.AvgLatencyMs, &r.P95LatencyMs)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.TopQueries, err = queryCounts(ctx, db, r.Since, top, false); err != nil {
+		return nil, err
+	}
+	if r.ZeroQueries, err = queryCounts(ctx, db, r.Since, top, true); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func queryCounts(ctx context.Context, db *sql.DB, since time.Time, top int, zeroOnly bool) ([]QueryCount, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT query, COUNT(*), AVG(total), COALESCE(AVG(top_score), 0)
+		FROM search_log
+		WHERE created_at >= $1 AND ($2 = FALSE OR zero_results)
+		GROUP BY query
+		ORDER BY COUNT(*) DESC, query
+		LIMIT $3`, since, zeroOnly, top)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+
+	list := make([]QueryCount, 0, top)
+	for rows.Next() {
+		var q QueryCount
+		if err := rows.Scan(&q.Query, &q.Count, &q.AvgResults, &q.AvgTopScore); err != nil {
+			return nil, err
+		}
+		list = append(list, q)
+	}
+	return list, rows.Err()
+}
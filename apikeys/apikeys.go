@@ -0,0 +1,168 @@
+// Package apikeys issues and checks the API keys used by internal tools.
+// Only the SHA-256 of a key is stored; the plaintext is shown once when the
+// key is created.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"movie-search-db/logging"
+)
+
+const keyPrefix = "msdb_"
+
+var (
+	ErrInvalidKey = errors.New("invalid api key")
+	ErrNotFound   = errors.New("api key not found")
+)
+
+type Key struct {
+	ID                 int
+	Name               string
+	Prefix             string
+	RateLimitPerMinute int
+	DailyQuota         int
+	Admin              bool
+	CreatedAt          time.Time
+	LastUsedAt         sql.NullTime
+	RevokedAt          sql.NullTime
+}
+
+func (k *Key) Revoked() bool { return k.RevokedAt.Valid }
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Generate returns a new random key.
+func Generate() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// displayPrefix is the part of a key that is safe to show in listings.
+func displayPrefix(key string) string {
+	return key[:len(keyPrefix)+8]
+}
+
+// Create stores a new key and returns it with its plaintext value.
+func (s *Store) Create(ctx context.Context, name string, ratePerMinute, dailyQuota int, admin bool) (*Key, string, error) {
+	plain, err := Generate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	k := &Key{Name: name, Prefix: displayPrefix(plain), RateLimitPerMinute: ratePerMinute, DailyQuota: dailyQuota, Admin: admin}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, rate_limit_per_minute, daily_quota, admin)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		name, k.Prefix, Hash(plain), ratePerMinute, dailyQuota, admin).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return k, plain, nil
+}
+
+// Revoke disables a key by id or by its display prefix.
+func (s *Store) Revoke(ctx context.Context, idOrPrefix string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = now()
+		WHERE (id::text = $1 OR prefix = $1) AND revoked_at IS NULL`, idOrPrefix)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, prefix, rate_limit_per_minute, daily_quota, admin, created_at, last_used_at, revoked_at
+		FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+
+	var keys []Key
+	for rows.Next() {
+		var k Key
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.RateLimitPerMinute, &k.DailyQuota, &k.Admin,
+			&k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Lookup resolves a plaintext key. Unknown and revoked keys both return
+// ErrInvalidKey.
+func (s *Store) Lookup(ctx context.Context, plain string) (*Key, error) {
+	if !strings.HasPrefix(plain, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	var k Key
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, prefix, rate_limit_per_minute, daily_quota, admin, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE key_hash = $1`, Hash(plain)).Scan(&k.ID, &k.Name, &k.Prefix,
+		&k.RateLimitPerMinute, &k.DailyQuota, &k.Admin, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.Revoked() {
+		return nil, ErrInvalidKey
+	}
+	return &k, nil
+}
+
+// CountRequest records one request for today (UTC) and returns the number
+// of requests made with the key today, including this one.
+func (s *Store) CountRequest(ctx context.Context, keyID int) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		WITH usage AS (
+			INSERT INTO api_key_usage (key_id, day, requests)
+			VALUES ($1, (now() AT TIME ZONE 'UTC')::date, 1)
+			ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+			RETURNING requests
+		), touch AS (
+			UPDATE api_keys SET last_used_at = now() WHERE id = $1
+		)
+		SELECT requests FROM usage`, keyID).Scan(&n)
+	return n, err
+}
+
+// UntilNextDay is how long a key that exhausted its daily quota has to wait.
+func UntilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(now)
+}
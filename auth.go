@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/apikeys"
+	"movie-search-db/ratelimit"
+)
+
+const localsAPIKey = "apiKey"
+
+// apiKeyAuth authenticates requests carrying an API key (X-API-Key or
+// "Authorization: Bearer"). Requests without a key pass through
+// anonymously and have to solve the captcha instead.
+func apiKeyAuth(c *fiber.Ctx) error {
+	plain := apiKeyFromRequest(c)
+	if plain == "" {
+		return c.Next()
+	}
+
+	key, err := apiKeyStore.Lookup(c.UserContext(), plain)
+	if errors.Is(err, apikeys.ErrInvalidKey) {
+		return errorJSON(c, 401, fiber.Map{"error": "invalid_api_key"})
+	}
+	if err != nil {
+		requestLogger(c).Error("api key lookup failed", "err", err)
+		return serverError(c, err, "database_error")
+	}
+
+	limit := ratelimit.PerMinute(key.RateLimitPerMinute, 0)
+	if ok, wait := takeToken(c, "key:"+strconv.Itoa(key.ID), limit); !ok {
+		return tooManyRequests(c, wait, "rate_limited")
+	}
+
+	used, err := apiKeyStore.CountRequest(c.UserContext(), key.ID)
+	if err != nil {
+		requestLogger(c).Error("api key usage update failed", "api_key_id", key.ID, "err", err)
+		return serverError(c, err, "database_error")
+	}
+	if key.DailyQuota > 0 && used > key.DailyQuota {
+		return tooManyRequests(c, apikeys.UntilNextDay(time.Now()), "quota_exceeded")
+	}
+
+	c.Locals(localsAPIKey, key)
+	return c.Next()
+}
+
+func apiKeyFromRequest(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// requestAPIKey returns the key the request was authenticated with, if any.
+func requestAPIKey(c *fiber.Ctx) *apikeys.Key {
+	key, _ := c.Locals(localsAPIKey).(*apikeys.Key)
+	return key
+}
+
+func tooManyRequests(c *fiber.Ctx, wait time.Duration, code string) error {
+	secs := max(ceilSeconds(wait), 1)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(secs))
+	return errorJSON(c, 429, fiber.Map{"error": code, "retryAfter": secs})
+}
@@ -0,0 +1,74 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"movie-search-db/logging"
+)
+
+// SiteVerify implements the siteverify protocol shared by reCAPTCHA,
+// hCaptcha and Turnstile.
+type SiteVerify struct {
+	Client *http.Client
+	URL    string
+	Secret string
+	// Action, when set, must match the action the token was issued for.
+	Action string
+	// Scored providers (reCAPTCHA v3) also have to reach MinScore.
+	Scored   bool
+	MinScore float64
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      float64  `json:"score"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *SiteVerify) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	data := url.Values{
+		"secret":   {v.Secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		data.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("siteverify_status_%d", resp.StatusCode)
+	}
+
+	var res siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, err
+	}
+
+	if !res.Success {
+		return false, nil
+	}
+	if v.Action != "" && res.Action != v.Action {
+		return false, nil
+	}
+	if v.Scored && res.Score < v.MinScore {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,106 @@
+// Package catalog tracks the version of the movie data. Batch jobs call
+// BumpIfChanged after a run; the API compares versions to know when its
+// cached results are stale.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"movie-search-db/logging"
+)
+
+type State struct {
+	Version   int64
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+func Current(ctx context.Context, db *sql.DB) (State, error) {
+	var s State
+	var by sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT version, updated_at, updated_by FROM catalog_state`).
+		Scan(&s.Version, &s.UpdatedAt, &by)
+	s.UpdatedBy = by.String
+	return s, err
+}
+
+// Bump records that job changed the catalog and returns the new version.
+func Bump(ctx context.Context, db *sql.DB, job string) (int64, error) {
+	var v int64
+	err := db.QueryRowContext(ctx, `
+		UPDATE catalog_state SET version = version + 1, updated_at = now(), updated_by = $1
+		RETURNING version`, job).Scan(&v)
+	return v, err
+}
+
+// BumpIfChanged bumps the version after a run of job that changed
+// movies, i.e. changed > 0, and logs the result. Jobs call it also when
+// they stop early, so it ignores the cancellation of ctx: movies committed
+// before an interrupt must still invalidate the cached results. A failed
+// bump is only logged: cached results then expire by their TTL.
+func BumpIfChanged(ctx context.Context, db *sql.DB, job string, changed int64) {
+	if changed == 0 {
+		slog.Info("catalog unchanged, version not bumped", "stage", "catalog")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if v, err := Bump(ctx, db, job); err != nil {
+		slog.Error("catalog version bump failed", "stage", "catalog", "err", err)
+	} else {
+		slog.Info("catalog version bumped", "stage", "catalog", "version", v)
+	}
+}
+
+type Counts struct {
+	Movies     int `json:"movies"`
+	Embedded   int `json:"embedded"`
+	Translated int `json:"translated"`
+}
+
+// Count returns how many movies there are, how many of them have a Turkish
+// overview and how many of those have an embedding. Only movies with a
+// Turkish overview are embedded, so Embedded never exceeds Translated.
+func Count(ctx context.Context, db *sql.DB) (Counts, error) {
+	var c Counts
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE embedding IS NOT NULL AND overview_tr IS NOT NULL),
+		       COUNT(*) FILTER (WHERE overview_tr IS NOT NULL)
+		FROM movies`).Scan(&c.Movies, &c.Embedded, &c.Translated)
+	return c, err
+}
+
+// Ref identifies a movie by its row id and TMDB id.
+type Ref struct {
+	ID     int
+	TmdbID int
+}
+
+// Refs lists the movies that have a TMDB id, most popular first. where is
+// an optional extra condition written by the caller, never user input;
+// args are its placeholder values.
+func Refs(ctx context.Context, db *sql.DB, where string, args ...any) ([]Ref, error) {
+	query := `SELECT id, tmdb_id FROM movies WHERE tmdb_id IS NOT NULL`
+	if where != "" {
+		query += ` AND (` + where + `)`
+	}
+	rows, err := db.QueryContext(ctx, query+` ORDER BY popularity DESC NULLS LAST`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+
+	var refs []Ref
+	for rows.Next() {
+		var r Ref
+		if err := rows.Scan(&r.ID, &r.TmdbID); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	updater "movie-search-db/data-updater"
+	"movie-search-db/database"
+	"movie-search-db/embed"
+	"movie-search-db/embedding"
+	translator "movie-search-db/language-translator"
+	"movie-search-db/logging"
+	"movie-search-db/migrations"
+	"movie-search-db/poster"
+	"movie-search-db/seed"
+	"movie-search-db/tmdb"
+	"movie-search-db/tmdbfake"
+)
+
+// errUsage marks invalid command line arguments; main exits with status 2.
+var errUsage = errors.New("invalid arguments")
+
+// newFlagSet returns a flag set for a subcommand. args describes the
+// positional arguments shown in the usage line.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	synopsis := "moviedb " + name + " [bayraklar]"
+	if args != "" {
+		synopsis += " " + args
+	}
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Kullanim: %s\n\nBayraklar:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args into fs. Invalid flags are reported as errUsage,
+// -h as flag.ErrHelp.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+// dsnFlag registers -dsn. When set it replaces the configured database.
+func dsnFlag(fs *flag.FlagSet) *string {
+	return fs.String("dsn", "", "Postgres baglanti dizesi veya postgres:// URL (bos ise DATABASE_URL ya da DB_*)")
+}
+
+// tmdbFlags registers -workers and -tmdb-key. The key is not used as flag
+// default so -h does not print it.
+func tmdbFlags(fs *flag.FlagSet, workers int, env string) (*int, *string) {
+	return fs.Int("workers", workers, "paralel calisan sayisi ("+env+")"),
+		fs.String("tmdb-key", "", "TMDB API okuma erisim anahtari, bearer token olarak gonderilir (bos ise TMDB_API_KEY)")
+}
+
+// openDB connects to dsn, or the configured database when dsn is empty,
+// and, when check is set, makes sure the schema matches the migrations
+// compiled into the binary.
+func openDB(ctx context.Context, dsn string, check bool) (*sql.DB, error) {
+	if dsn == "" {
+		dsn = cfg.Database.DSN()
+	}
+	db, err := database.Open(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if check {
+		if err := migrations.Check(ctx, db); err != nil {
+			closeDB(db)
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func closeDB(db *sql.DB) {
+	logging.CloseQuietly(db)
+}
+
+// validate reports configuration problems found by the given checks.
+func validate(checks ...func() error) error {
+	var errs []error
+	for _, check := range checks {
+		errs = append(errs, check())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+func runSeed(ctx context.Context, args []string) error {
+	fs := newFlagSet("seed", "")
+	dataDir := fs.String("data-dir", cfg.Jobs.DataDir, "movies_metadata.csv, keywords.csv ve credits.csv dizini (SEED_DATA_DIR)")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		if err := validate(cfg.Validate); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	return seed.Run(ctx, db, seed.Options{DataDir: *dataDir})
+}
+
+// tmdbJob adds the common flags of the commands that call the TMDB API to
+// fs, parses args and returns the database, the TMDB client shared by the
+// workers and the worker count to use. flagChecks run right after parsing,
+// before anything is connected.
+func tmdbJob(ctx context.Context, fs *flag.FlagSet, args []string, workers int, env string, flagChecks ...func() error) (*sql.DB, *tmdb.Client, int, error) {
+	n, key := tmdbFlags(fs, workers, env)
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, nil, 0, err
+	}
+	for _, check := range flagChecks {
+		if err := check(); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if *key != "" {
+		cfg.TMDB.APIKey = *key
+	}
+	if *n < 1 {
+		return nil, nil, 0, fmt.Errorf("%w: -workers must be positive", errUsage)
+	}
+	checks := []func() error{cfg.ValidateTMDB}
+	if *dsn == "" {
+		checks = append(checks, cfg.Validate)
+	}
+	if err := validate(checks...); err != nil {
+		return nil, nil, 0, err
+	}
+	client, err := tmdb.New(cfg.TMDBConfig())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return db, client, *n, nil
+}
+
+func runSync(ctx context.Context, args []string) error {
+	fs := newFlagSet("sync", "")
+	freshness := fs.Duration("freshness", cfg.Jobs.SyncFreshness, "bu sure icinde senkronize edilen filmleri atlar, 0 hepsini gunceller (SYNC_FRESHNESS)")
+	onlyFailed := fs.Bool("only-failed", false, "sadece son denemesi hata veren filmleri tekrar dener")
+	incremental := fs.Bool("incremental", false, "sadece TMDB'de degisen filmleri ve vizyondaki/populer yeni filmleri senkronize eder")
+	since := fs.String("since", "", "-incremental: degisiklikleri bu tarihten itibaren okur (2006-01-02 veya RFC3339, bos ise son basarili calisma)")
+	pages := fs.Int("pages", cfg.Jobs.SyncListPages, "-incremental: okunacak now_playing ve popular sayfa sayisi (SYNC_LIST_PAGES)")
+	db, client, workers, err := tmdbJob(ctx, fs, args, cfg.Jobs.SyncWorkers, "SYNC_WORKERS",
+		func() error { return incrementalFlagsOK(fs, *incremental) })
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	opts := updater.Options{
+		Workers:    workers,
+		TMDB:       client,
+		Freshness:  *freshness,
+		OnlyFailed: *onlyFailed,
+	}
+	if !*incremental {
+		return updater.Run(ctx, db, opts)
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		if sinceTime, err = parseTime(*since); err != nil {
+			return fmt.Errorf("%w: -since: %v", errUsage, err)
+		}
+	}
+	return updater.RunIncremental(ctx, db, updater.IncrementalOptions{
+		Options:   opts,
+		Since:     sinceTime,
+		Lookback:  cfg.Jobs.SyncLookback,
+		ListPages: *pages,
+	})
+}
+
+// incrementalFlagsOK rejects flags that only apply to one kind of sync:
+// -only-failed and -freshness select movies of the catalog, which an
+// incremental run does not do, and -since and -pages only exist for it.
+func incrementalFlagsOK(fs *flag.FlagSet, incremental bool) error {
+	var conflicts []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "only-failed", "freshness":
+			if incremental {
+				conflicts = append(conflicts, "-"+f.Name)
+			}
+		case "since", "pages":
+			if !incremental {
+				conflicts = append(conflicts, "-"+f.Name)
+			}
+		}
+	})
+	switch {
+	case len(conflicts) == 0:
+		return nil
+	case incremental:
+		return fmt.Errorf("%w: %s cannot be combined with -incremental", errUsage, strings.Join(conflicts, ", "))
+	}
+	return fmt.Errorf("%w: %s requires -incremental", errUsage, strings.Join(conflicts, ", "))
+}
+
+// parseTime accepts a date or an RFC 3339 timestamp.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func runFakeTMDB(_ context.Context, args []string) error {
+	fs := newFlagSet("fake-tmdb", "")
+	addr := fs.String("addr", ":8099", "dinlenecek adres")
+	moviesFile := fs.String("movies", "tmdb-fake.example.json", "sunulacak filmlerin JSON dosyasi")
+	apiKey := fs.String("api-key", "", "bos degilse istenen API anahtari")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	movies, err := tmdbfake.Load(*moviesFile)
+	if err != nil {
+		return err
+	}
+	slog.Info("fake tmdb listening", "addr", *addr, "movies", len(movies))
+	return http.ListenAndServe(*addr, &tmdbfake.Server{Movies: movies, APIKey: *apiKey})
+}
+
+func runPosters(ctx context.Context, args []string) error {
+	db, client, workers, err := tmdbJob(ctx, newFlagSet("posters", ""), args, cfg.Jobs.PosterWorkers, "POSTER_WORKERS")
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	return poster.Run(ctx, db, poster.Options{Workers: workers, TMDB: client})
+}
+
+func runTranslate(ctx context.Context, args []string) error {
+	db, client, workers, err := tmdbJob(ctx, newFlagSet("translate", ""), args, cfg.Jobs.TranslateWorkers, "TRANSLATE_WORKERS")
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	return translator.Run(ctx, db, translator.Options{Workers: workers, TMDB: client})
+}
+
+func runEmbed(ctx context.Context, args []string) error {
+	fs := newFlagSet("embed", "")
+	workers := fs.Int("workers", cfg.Jobs.EmbedWorkers, "paralel calisan sayisi (EMBED_WORKERS)")
+	batchSize := fs.Int("batch-size", cfg.Jobs.EmbedBatchSize, "tek istekte embed edilen film sayisi (EMBED_BATCH_SIZE)")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *workers < 1 || *batchSize < 1 {
+		return fmt.Errorf("%w: -workers and -batch-size must be positive", errUsage)
+	}
+	checks := []func() error{cfg.ValidateEmbedding}
+	if *dsn == "" {
+		checks = append(checks, cfg.Validate)
+	}
+	if err := validate(checks...); err != nil {
+		return err
+	}
+
+	embCfg := cfg.EmbeddingConfig()
+	embCfg.Timeout = cfg.Jobs.EmbedTimeout
+	embedder, err := embedding.New(embCfg)
+	if err != nil {
+		return fmt.Errorf("invalid embedding config: %w", err)
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	return embed.Run(ctx, db, embedder, embed.Options{Workers: *workers, BatchSize: *batchSize})
+}
+
+func runConfig(_ context.Context, args []string) error {
+	fs := newFlagSet("config", "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout)
+}
@@ -0,0 +1,409 @@
+// Package config loads the settings shared by the API server and the batch
+// commands into one typed struct.
+//
+// Values are read, from lowest to highest precedence, from the built-in
+// defaults, an optional YAML (.yaml, .yml) or TOML (.toml) file, the .env
+// file and the process environment. Every field is named after its
+// environment variable in the env tag; the file uses the yaml/toml keys,
+// e.g.
+//
+//	database:
+//	  host: db
+//	  name: movie_ai
+//	server:
+//	  addr: ":8080"
+//
+// Command line flags of moviedb override the loaded values.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"movie-search-db/captcha"
+	"movie-search-db/embedding"
+	"movie-search-db/tmdb"
+)
+
+type Config struct {
+	Database  Database  `yaml:"database" toml:"database"`
+	Server    Server    `yaml:"server" toml:"server"`
+	Captcha   Captcha   `yaml:"captcha" toml:"captcha"`
+	Embedding Embedding `yaml:"embedding" toml:"embedding"`
+	TMDB      TMDB      `yaml:"tmdb" toml:"tmdb"`
+	Jobs      Jobs      `yaml:"jobs" toml:"jobs"`
+	Search    Search    `yaml:"search" toml:"search"`
+	Cache     Cache     `yaml:"cache" toml:"cache"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	SearchLog SearchLog `yaml:"search_log" toml:"search_log"`
+	Log       Log       `yaml:"log" toml:"log"`
+	Metrics   Metrics   `yaml:"metrics" toml:"metrics"`
+}
+
+type Database struct {
+	// URL is a postgres:// connection URL. When set it is used instead of
+	// the separate fields below.
+	URL      string `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"url"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+type Server struct {
+	Addr                  string        `yaml:"addr" toml:"addr" env:"LISTEN_ADDR"`
+	ReadTimeout           time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT"`
+	RequestTimeout        time.Duration `yaml:"request_timeout" toml:"request_timeout" env:"REQUEST_TIMEOUT"`
+	ShutdownTimeout       time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	CORSAllowOrigins      string        `yaml:"cors_allow_origins" toml:"cors_allow_origins" env:"CORS_ALLOW_ORIGINS"`
+	TrustedProxies        []string      `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	RankingProfilesFile   string        `yaml:"ranking_profiles_file" toml:"ranking_profiles_file" env:"RANKING_PROFILES_FILE"`
+	ReadyTimeout          time.Duration `yaml:"ready_timeout" toml:"ready_timeout" env:"READY_TIMEOUT"`
+	ReadyMinEmbeddedRatio float64       `yaml:"ready_min_embedded_ratio" toml:"ready_min_embedded_ratio" env:"READY_MIN_EMBEDDED_RATIO"`
+}
+
+type Captcha struct {
+	Provider string `yaml:"provider" toml:"provider" env:"CAPTCHA_PROVIDER"`
+	Secret   string `yaml:"secret" toml:"secret" env:"CAPTCHA_SECRET" secret:"true"`
+	// RecaptchaPrivateKey is the older name of the recaptcha secret and is
+	// used when Secret is empty.
+	RecaptchaPrivateKey string        `yaml:"recaptcha_private_key" toml:"recaptcha_private_key" env:"RECAPTCHA_PRIVATE_KEY" secret:"true"`
+	MinScore            float64       `yaml:"min_score" toml:"min_score" env:"CAPTCHA_MIN_SCORE"`
+	Action              string        `yaml:"action" toml:"action" env:"CAPTCHA_ACTION"`
+	StubToken           string        `yaml:"stub_token" toml:"stub_token" env:"CAPTCHA_STUB_TOKEN" secret:"true"`
+	Timeout             time.Duration `yaml:"timeout" toml:"timeout" env:"CAPTCHA_TIMEOUT"`
+}
+
+type Embedding struct {
+	Provider      string        `yaml:"provider" toml:"provider" env:"EMBEDDING_PROVIDER"`
+	Model         string        `yaml:"model" toml:"model" env:"EMBEDDING_MODEL"`
+	Dimension     int           `yaml:"dimension" toml:"dimension" env:"EMBEDDING_DIMENSION"`
+	OllamaBaseURL string        `yaml:"ollama_base_url" toml:"ollama_base_url" env:"OLLAMA_BASE_URL"`
+	OpenAIBaseURL string        `yaml:"openai_base_url" toml:"openai_base_url" env:"OPENAI_BASE_URL"`
+	OpenAIAPIKey  string        `yaml:"openai_api_key" toml:"openai_api_key" env:"OPENAI_API_KEY" secret:"true"`
+	Timeout       time.Duration `yaml:"timeout" toml:"timeout" env:"EMBEDDING_TIMEOUT"`
+}
+
+// TMDB.RateLimit is in requests per second, shared by all workers.
+type TMDB struct {
+	APIKey     string        `yaml:"api_key" toml:"api_key" env:"TMDB_API_KEY" secret:"true"`
+	BaseURL    string        `yaml:"base_url" toml:"base_url" env:"TMDB_BASE_URL"`
+	Timeout    time.Duration `yaml:"timeout" toml:"timeout" env:"TMDB_TIMEOUT"`
+	RateLimit  float64       `yaml:"rate_limit" toml:"rate_limit" env:"TMDB_RATE_LIMIT"`
+	Burst      int           `yaml:"burst" toml:"burst" env:"TMDB_BURST"`
+	MaxRetries int           `yaml:"max_retries" toml:"max_retries" env:"TMDB_MAX_RETRIES"`
+}
+
+type Jobs struct {
+	DataDir          string        `yaml:"data_dir" toml:"data_dir" env:"SEED_DATA_DIR"`
+	SyncWorkers      int           `yaml:"sync_workers" toml:"sync_workers" env:"SYNC_WORKERS"`
+	SyncFreshness    time.Duration `yaml:"sync_freshness" toml:"sync_freshness" env:"SYNC_FRESHNESS"`
+	SyncListPages    int           `yaml:"sync_list_pages" toml:"sync_list_pages" env:"SYNC_LIST_PAGES"`
+	SyncLookback     time.Duration `yaml:"sync_lookback" toml:"sync_lookback" env:"SYNC_LOOKBACK"`
+	PosterWorkers    int           `yaml:"poster_workers" toml:"poster_workers" env:"POSTER_WORKERS"`
+	TranslateWorkers int           `yaml:"translate_workers" toml:"translate_workers" env:"TRANSLATE_WORKERS"`
+	EmbedWorkers     int           `yaml:"embed_workers" toml:"embed_workers" env:"EMBED_WORKERS"`
+	EmbedBatchSize   int           `yaml:"embed_batch_size" toml:"embed_batch_size" env:"EMBED_BATCH_SIZE"`
+	EmbedTimeout     time.Duration `yaml:"embed_timeout" toml:"embed_timeout" env:"EMBED_TIMEOUT"`
+}
+
+// MaxEfSearch is the largest hnsw.ef_search pgvector accepts. hnsw scans
+// return at most ef_search rows, so it also bounds SEARCH_CANDIDATES.
+const MaxEfSearch = 1000
+
+// Search.IterativeScan strict_order and relaxed_order need pgvector 0.8 or
+// newer; use off on older versions. Without iterative scans filtered
+// searches fall back to an exact scan.
+type Search struct {
+	Candidates    int    `yaml:"candidates" toml:"candidates" env:"SEARCH_CANDIDATES"`
+	EfSearch      int    `yaml:"hnsw_ef_search" toml:"hnsw_ef_search" env:"SEARCH_HNSW_EF_SEARCH"`
+	Probes        int    `yaml:"ivfflat_probes" toml:"ivfflat_probes" env:"SEARCH_IVFFLAT_PROBES"`
+	IterativeScan string `yaml:"iterative_scan" toml:"iterative_scan" env:"SEARCH_ITERATIVE_SCAN"`
+}
+
+// Cache sizes of 0 disable the cache.
+type Cache struct {
+	EmbeddingSize    int           `yaml:"embedding_size" toml:"embedding_size" env:"EMBEDDING_CACHE_SIZE"`
+	EmbeddingTTL     time.Duration `yaml:"embedding_ttl" toml:"embedding_ttl" env:"EMBEDDING_CACHE_TTL"`
+	EmbeddingPersist bool          `yaml:"embedding_persist" toml:"embedding_persist" env:"EMBEDDING_CACHE_PERSIST"`
+	ResultSize       int           `yaml:"result_size" toml:"result_size" env:"RESULT_CACHE_SIZE"`
+	ResultTTL        time.Duration `yaml:"result_ttl" toml:"result_ttl" env:"RESULT_CACHE_TTL"`
+	ResultPoll       time.Duration `yaml:"result_poll" toml:"result_poll" env:"RESULT_CACHE_POLL"`
+}
+
+type RateLimit struct {
+	Store       string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`
+	IPPerMinute int    `yaml:"ip_per_minute" toml:"ip_per_minute" env:"RATE_LIMIT_IP_PER_MINUTE"`
+	IPBurst     int    `yaml:"ip_burst" toml:"ip_burst" env:"RATE_LIMIT_IP_BURST"`
+}
+
+type SearchLog struct {
+	Enabled   bool          `yaml:"enabled" toml:"enabled" env:"SEARCH_LOG_ENABLED"`
+	Salt      string        `yaml:"salt" toml:"salt" env:"SEARCH_LOG_SALT" secret:"true"`
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"SEARCH_LOG_RETENTION"`
+	Buffer    int           `yaml:"buffer" toml:"buffer" env:"SEARCH_LOG_BUFFER"`
+}
+
+type Log struct {
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+}
+
+type Metrics struct {
+	Addr           string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	PushgatewayURL string `yaml:"pushgateway_url" toml:"pushgateway_url" env:"METRICS_PUSHGATEWAY_URL"`
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "require",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Server: Server{
+			Addr:                  ":8080",
+			ReadTimeout:           10 * time.Second,
+			RequestTimeout:        10 * time.Second,
+			ShutdownTimeout:       15 * time.Second,
+			CORSAllowOrigins:      "*",
+			ReadyTimeout:          3 * time.Second,
+			ReadyMinEmbeddedRatio: 0.5,
+		},
+		Captcha: Captcha{
+			Provider: captcha.ProviderRecaptcha,
+			MinScore: captcha.DefaultMinScore,
+			Timeout:  5 * time.Second,
+		},
+		Embedding: Embedding{
+			Provider:  embedding.ProviderOllama,
+			Model:     embedding.DefaultModel,
+			Dimension: embedding.ColumnDimension,
+			Timeout:   30 * time.Second,
+		},
+		TMDB: TMDB{
+			BaseURL:    tmdb.DefaultBaseURL,
+			Timeout:    15 * time.Second,
+			RateLimit:  tmdb.DefaultRateLimit,
+			Burst:      tmdb.DefaultRateLimit,
+			MaxRetries: tmdb.DefaultMaxRetries,
+		},
+		Jobs: Jobs{
+			DataDir:          "datas",
+			SyncWorkers:      15,
+			SyncFreshness:    24 * time.Hour,
+			SyncListPages:    3,
+			SyncLookback:     24 * time.Hour,
+			PosterWorkers:    20,
+			TranslateWorkers: 20,
+			EmbedWorkers:     4,
+			EmbedBatchSize:   32,
+			EmbedTimeout:     60 * time.Second,
+		},
+		Search: Search{
+			Candidates:    200,
+			EfSearch:      200,
+			Probes:        10,
+			IterativeScan: "relaxed_order",
+		},
+		Cache: Cache{
+			EmbeddingSize: 1000,
+			EmbeddingTTL:  24 * time.Hour,
+			ResultSize:    500,
+			ResultTTL:     5 * time.Minute,
+			ResultPoll:    15 * time.Second,
+		},
+		RateLimit: RateLimit{Store: "memory", IPPerMinute: 30},
+		SearchLog: SearchLog{
+			Enabled:   true,
+			Retention: 90 * 24 * time.Hour,
+			Buffer:    1000,
+		},
+		Log: Log{Format: "text", Level: "info"},
+	}
+}
+
+// DSN returns the lib/pq connection string: URL when set, otherwise one
+// built from the separate fields.
+func (d Database) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSN(d.Host), d.Port, quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.Name), quoteDSN(d.SSLMode))
+}
+
+// quoteDSN quotes a key/value connection string value when it is empty or
+// contains spaces, quotes or backslashes.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// CaptchaConfig returns the settings of the captcha verifier.
+func (c *Config) CaptchaConfig() captcha.Config {
+	cc := captcha.Config{
+		Provider:  strings.ToLower(c.Captcha.Provider),
+		Secret:    c.Captcha.Secret,
+		MinScore:  c.Captcha.MinScore,
+		Action:    c.Captcha.Action,
+		StubToken: c.Captcha.StubToken,
+		Timeout:   c.Captcha.Timeout,
+	}
+	if cc.Secret == "" && cc.Provider == captcha.ProviderRecaptcha {
+		cc.Secret = c.Captcha.RecaptchaPrivateKey
+	}
+	return cc
+}
+
+// EmbeddingConfig returns the settings of the embedding provider. The base
+// URL is OllamaBaseURL or OpenAIBaseURL depending on the provider.
+func (c *Config) EmbeddingConfig() embedding.Config {
+	ec := embedding.Config{
+		Provider:  strings.ToLower(c.Embedding.Provider),
+		Model:     c.Embedding.Model,
+		Dimension: c.Embedding.Dimension,
+		Timeout:   c.Embedding.Timeout,
+	}
+	switch ec.Provider {
+	case embedding.ProviderOllama:
+		ec.BaseURL = c.Embedding.OllamaBaseURL
+	case embedding.ProviderOpenAI:
+		ec.BaseURL = c.Embedding.OpenAIBaseURL
+		ec.APIKey = c.Embedding.OpenAIAPIKey
+	}
+	return ec
+}
+
+// TMDBConfig returns the settings of the TMDB client.
+func (c *Config) TMDBConfig() tmdb.Config {
+	return tmdb.Config{
+		APIKey:     c.TMDB.APIKey,
+		BaseURL:    c.TMDB.BaseURL,
+		Timeout:    c.TMDB.Timeout,
+		RateLimit:  c.TMDB.RateLimit,
+		Burst:      c.TMDB.Burst,
+		MaxRetries: c.TMDB.MaxRetries,
+	}
+}
+
+// Validate checks the settings every command uses.
+func (c *Config) Validate() error {
+	var errs []error
+	d := c.Database
+	if d.URL != "" {
+		if u, err := url.Parse(d.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			errs = append(errs, errors.New("DATABASE_URL must be a postgres:// URL"))
+		}
+	} else {
+		if d.User == "" {
+			errs = append(errs, errors.New("DB_USER is empty (or set DATABASE_URL)"))
+		}
+		if d.Name == "" {
+			errs = append(errs, errors.New("DB_NAME is empty (or set DATABASE_URL)"))
+		}
+	}
+	if !slices.Contains([]string{"text", "json"}, strings.ToLower(c.Log.Format)) {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be text or json, got %q", c.Log.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateServe checks the settings the API server needs, so a missing
+// captcha secret stops the server at start instead of failing every search.
+func (c *Config) ValidateServe() error {
+	errs := []error{c.Validate(), c.ValidateEmbedding()}
+	if err := c.CaptchaConfig().Validate(); err != nil {
+		if c.Captcha.Provider == captcha.ProviderRecaptcha && c.Captcha.Secret == "" {
+			err = fmt.Errorf("%w: set CAPTCHA_SECRET or RECAPTCHA_PRIVATE_KEY", err)
+		}
+		errs = append(errs, err)
+	}
+	s := c.Server
+	for name, d := range map[string]time.Duration{
+		"READ_TIMEOUT":     s.ReadTimeout,
+		"REQUEST_TIMEOUT":  s.RequestTimeout,
+		"SHUTDOWN_TIMEOUT": s.ShutdownTimeout,
+		"READY_TIMEOUT":    s.ReadyTimeout,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	if s.ReadyMinEmbeddedRatio < 0 || s.ReadyMinEmbeddedRatio > 1 {
+		errs = append(errs, errors.New("READY_MIN_EMBEDDED_RATIO must be between 0 and 1"))
+	}
+	if !slices.Contains([]string{"memory", "postgres"}, c.RateLimit.Store) {
+		errs = append(errs, errors.New("RATE_LIMIT_STORE must be memory or postgres"))
+	}
+	if c.RateLimit.IPPerMinute < 1 {
+		errs = append(errs, errors.New("RATE_LIMIT_IP_PER_MINUTE must be positive"))
+	}
+	// empty and off skip the setting, for pgvector versions without iterative scans
+	if !slices.Contains([]string{"", "off", "strict_order", "relaxed_order"}, c.Search.IterativeScan) {
+		errs = append(errs, errors.New("SEARCH_ITERATIVE_SCAN must be off, strict_order or relaxed_order"))
+	}
+	if c.Search.Candidates < 1 || c.Search.Candidates > MaxEfSearch {
+		errs = append(errs, fmt.Errorf("SEARCH_CANDIDATES must be between 1 and %d", MaxEfSearch))
+	}
+	if c.Search.EfSearch > MaxEfSearch {
+		errs = append(errs, fmt.Errorf("SEARCH_HNSW_EF_SEARCH must be at most %d", MaxEfSearch))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateEmbedding checks the embedding provider settings.
+func (c *Config) ValidateEmbedding() error {
+	return c.EmbeddingConfig().Validate()
+}
+
+// ValidateTMDB checks the settings of the commands that call the TMDB API.
+func (c *Config) ValidateTMDB() error {
+	var errs []error
+	switch {
+	case c.TMDB.APIKey == "":
+		errs = append(errs, errors.New("TMDB_API_KEY is empty"))
+	case isTMDBv3Key(c.TMDB.APIKey):
+		errs = append(errs, errors.New("TMDB_API_KEY is a v3 API key; it is sent as bearer token, which needs the API Read Access Token (TMDB settings > API)"))
+	}
+	if u, err := url.Parse(c.TMDB.BaseURL); err != nil || u.Host == "" {
+		errs = append(errs, errors.New("TMDB_BASE_URL must be an absolute URL"))
+	}
+	if c.TMDB.RateLimit <= 0 {
+		errs = append(errs, errors.New("TMDB_RATE_LIMIT must be positive"))
+	}
+	if c.TMDB.MaxRetries < 0 {
+		errs = append(errs, errors.New("TMDB_MAX_RETRIES must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// isTMDBv3Key reports whether key has the form of a v3 API key, 32 hex
+// digits. Read access tokens are JWTs.
+func isTMDBv3Key(key string) bool {
+	if len(key) != 32 {
+		return false
+	}
+	for _, r := range key {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "******"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load returns the configuration read from the defaults, the file at path
+// (skipped when path is empty), .env and the environment. Malformed values
+// are errors; use Validate for missing ones.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	// .env does not override variables that are already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf(".env: %w", err)
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		md, err := toml.Decode(string(raw), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %s", undecoded[0])
+		}
+		return nil
+	}
+	return errors.New("unsupported format, use .yaml, .yml or .toml")
+}
+
+// applyEnv sets every field whose env variable is set to a non-empty value.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			if err := applyEnv(fv); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.Tag.Get("env")
+		raw := os.Getenv(name)
+		if name == "" || raw == "" {
+			continue
+		}
+		if err := setField(fv, raw); err != nil {
+			return fmt.Errorf("%s=%q: %w", name, raw, err)
+		}
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, raw string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// Print writes the effective configuration to w as KEY=value lines, in the
+// format of .env. Secrets are replaced by ******, the password of
+// DATABASE_URL is shown as xxxxx.
+func (c *Config) Print(w io.Writer) error {
+	return printEnv(w, reflect.ValueOf(c).Elem())
+}
+
+func printEnv(w io.Writer, v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			if err := printEnv(w, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.Tag.Get("env"), formatField(fv, f.Tag.Get("secret"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatField(fv reflect.Value, secret string) string {
+	switch {
+	case fv.Type() == durationType:
+		return time.Duration(fv.Int()).String()
+	case fv.Kind() == reflect.Slice:
+		return strings.Join(fv.Interface().([]string), ",")
+	case fv.Kind() != reflect.String:
+		return fmt.Sprint(fv.Interface())
+	}
+
+	s := fv.String()
+	if s == "" {
+		return s
+	}
+	switch secret {
+	case "true":
+		return redacted
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil {
+			return redacted
+		}
+		return u.Redacted()
+	}
+	return s
+}
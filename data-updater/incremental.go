@@ -0,0 +1,255 @@
+package updater
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+
+	"movie-search-db/catalog"
+	"movie-search-db/logging"
+	"movie-search-db/metrics"
+	"movie-search-db/pool"
+	"movie-search-db/tmdb"
+)
+
+const (
+	// changesFeed names the checkpoint of the TMDB changes feed in
+	// sync_checkpoints.
+	changesFeed = "tmdb_changes"
+
+	DefaultListPages = 3
+	DefaultLookback  = 24 * time.Hour
+)
+
+type IncrementalOptions struct {
+	Options
+	// Since overrides the start of the changes feed. When zero the start
+	// time of the last successful incremental run is used, or Lookback
+	// before now on the first run.
+	Since    time.Time
+	Lookback time.Duration
+	// ListPages is the number of now_playing and popular pages read.
+	ListPages int
+}
+
+// target is a movie picked by the incremental sync; ID is 0 for movies
+// that are not in the catalog yet.
+type target struct {
+	ID     int
+	TmdbID int
+}
+
+// RunIncremental syncs only what changed on TMDB: movies of the catalog
+// listed by /movie/changes since the last run, and the movies of
+// /movie/now_playing and /movie/popular, which are inserted when new.
+// Changed movies unknown to the catalog are ignored; the changes feed
+// covers all of TMDB.
+func RunIncremental(ctx context.Context, db *sql.DB, opts IncrementalOptions) error {
+	start := time.Now()
+	if opts.ListPages < 1 {
+		opts.ListPages = DefaultListPages
+	}
+	if opts.Lookback <= 0 {
+		opts.Lookback = DefaultLookback
+	}
+
+	since := opts.Since
+	if since.IsZero() {
+		var err error
+		if since, err = checkpoint(ctx, db, changesFeed); err != nil {
+			return fmt.Errorf("reading checkpoint: %w", err)
+		}
+	}
+	if since.IsZero() {
+		since = start.Add(-opts.Lookback)
+	}
+
+	changed, listed, err := readFeeds(ctx, opts.TMDB, since, start, opts.ListPages)
+	if err != nil {
+		return err
+	}
+	known, err := knownMovies(ctx, db, slices.Concat(changed, listed))
+	if err != nil {
+		return fmt.Errorf("resolving movies: %w", err)
+	}
+	targets := pickTargets(known, changed, listed)
+	slog.Info("incremental sync started", "stage", "select", "since", since, "changed", len(changed),
+		"listed", len(listed), "movies", len(targets), "workers", opts.Workers)
+
+	job := metrics.StartJob("sync_incremental")
+	// Failed new movies have no movie_sync_state row to record the failure
+	// in; while there are any the checkpoint stays put so the next run
+	// reads the same feed again.
+	var lost atomic.Int64
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	err = pool.Run(ctx, opts.Workers, targets, func(ctx context.Context, t target) {
+		start := time.Now()
+		m := catalog.Ref{ID: t.ID, TmdbID: t.TmdbID}
+		data, err := fetchMovie(ctx, opts.TMDB, t.TmdbID)
+		if err != nil {
+			if t.ID == 0 && !errors.Is(err, tmdb.ErrNotFound) {
+				lost.Add(1)
+			}
+			fetchFailed(ctx, db, m, err, job, abort)
+			return
+		}
+		if t.ID != 0 {
+			err = saveMovie(ctx, db, t.ID, data)
+		} else {
+			m.ID, err = insertMovie(ctx, db, opts.TMDB, t.TmdbID, data)
+		}
+		if err != nil {
+			slog.Error("movie sync failed", "stage", "update", "movie_id", m.ID, "tmdb_id", t.TmdbID, "err", err)
+			if t.ID != 0 {
+				recordFailure(ctx, db, m, err)
+			} else {
+				lost.Add(1)
+			}
+			job.Failed(1)
+			return
+		}
+		slog.Info("movie synced", "movie_id", m.ID, "tmdb_id", t.TmdbID, "title", data.Title,
+			"new", t.ID == 0, "duration", time.Since(start))
+		job.OK(1)
+	})
+	catalog.BumpIfChanged(ctx, db, "sync", job.Succeeded())
+	if err != nil {
+		return context.Cause(ctx)
+	}
+
+	switch {
+	case job.Err() != nil:
+	case lost.Load() > 0:
+		slog.Warn("new movies failed, checkpoint not advanced", "stage", "checkpoint", "movies", lost.Load(), "since", since)
+	default:
+		if err := setCheckpoint(ctx, db, changesFeed, start); err != nil {
+			slog.Error("checkpoint write failed", "stage", "checkpoint", "err", err)
+		}
+	}
+	job.Finish()
+	slog.Info("incremental sync finished", "movies", len(targets), "duration", time.Since(start))
+	return job.Err()
+}
+
+// readFeeds returns the movies TMDB reports as changed between from and
+// to, and the movies of the first pages of now_playing and popular.
+func readFeeds(ctx context.Context, client *tmdb.Client, from, to time.Time, pages int) (changed, listed []int, err error) {
+	changed, err = client.Changes(ctx, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading changes: %w", err)
+	}
+	for _, path := range []string{"/movie/now_playing", "/movie/popular"} {
+		ids, err := client.IDs(ctx, path, url.Values{"language": {"tr-TR"}}, pages)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading lists: %w", err)
+		}
+		listed = append(listed, ids...)
+	}
+	return changed, listed, nil
+}
+
+// knownMovies maps the TMDB ids that are in the catalog to their movie id.
+func knownMovies(ctx context.Context, db *sql.DB, tmdbIDs []int) (map[int]int, error) {
+	all := make([]int64, 0, len(tmdbIDs))
+	for _, id := range tmdbIDs {
+		all = append(all, int64(id))
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, tmdb_id FROM movies WHERE tmdb_id = ANY($1)`, pq.Array(all))
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+
+	known := make(map[int]int)
+	for rows.Next() {
+		var id, tmdbID int
+		if err := rows.Scan(&id, &tmdbID); err != nil {
+			return nil, err
+		}
+		known[tmdbID] = id
+	}
+	return known, rows.Err()
+}
+
+// pickTargets returns the movies to sync, each once. Changed ids are kept
+// only when the movie is in known, listed ids always.
+func pickTargets(known map[int]int, changed, listed []int) []target {
+	seen := make(map[int]bool)
+	var targets []target
+	add := func(tmdbID int, onlyKnown bool) {
+		id, ok := known[tmdbID]
+		if seen[tmdbID] || (onlyKnown && !ok) {
+			return
+		}
+		seen[tmdbID] = true
+		targets = append(targets, target{ID: id, TmdbID: tmdbID})
+	}
+	for _, id := range listed {
+		add(id, false)
+	}
+	for _, id := range changed {
+		add(id, true)
+	}
+	return targets
+}
+
+// insertMovie adds a movie that is new to the catalog with its English
+// texts, then stores the Turkish data like any synced movie. The row has
+// no embedding yet, so the next embed run picks it up.
+func insertMovie(ctx context.Context, db *sql.DB, client *tmdb.Client, tmdbID int, data *tmdb.Movie) (int, error) {
+	en, err := client.Movie(ctx, tmdbID, "en-US")
+	if err != nil {
+		return 0, fmt.Errorf("fetch en: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO movies (tmdb_id, title, tagline, overview)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tmdb_id) DO UPDATE SET tmdb_id = EXCLUDED.tmdb_id
+		RETURNING id`, tmdbID, en.Title, en.Tagline, en.Overview).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := performUpdate(ctx, tx, id, data); err != nil {
+		return 0, err
+	}
+	if err := markSynced(ctx, tx, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// checkpoint returns the stored time of feed, or the zero time.
+func checkpoint(ctx context.Context, db *sql.DB, feed string) (time.Time, error) {
+	var t time.Time
+	err := db.QueryRowContext(ctx, `SELECT synced_at FROM sync_checkpoints WHERE name = $1`, feed).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+func setCheckpoint(ctx context.Context, db *sql.DB, feed string, t time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO sync_checkpoints (name, synced_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET synced_at = EXCLUDED.synced_at`, feed, t)
+	return err
+}
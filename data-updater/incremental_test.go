@@ -0,0 +1,151 @@
+package updater
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"movie-search-db/database"
+	"movie-search-db/migrations"
+	"movie-search-db/tmdb"
+	"movie-search-db/tmdbfake"
+)
+
+const (
+	knownTmdbID   = 862
+	newTmdbID     = 1000001
+	unknownTmdbID = 1000002
+)
+
+// fakeTMDB serves a known movie that changed, a new movie in now_playing
+// and a changed movie that is neither in the catalog nor in a list. It
+// returns the base URL.
+func fakeTMDB(t *testing.T) string {
+	t.Helper()
+	changed := time.Now().Add(-time.Hour)
+	srv := httptest.NewServer(&tmdbfake.Server{
+		APIKey: "test-token",
+		Movies: []tmdbfake.Movie{
+			{ID: knownTmdbID, Title: "Toy Story", TitleTR: "Oyuncak Hikayesi", OverviewTR: "Andy'nin oyuncaklari.",
+				ReleaseDate: "1995-10-30", Director: "John Lasseter", Genres: []string{"Animation"}, ChangedAt: changed},
+			{ID: newTmdbID, Title: "A New Release", TitleTR: "Yeni Bir Film", ReleaseDate: "2026-10-01",
+				Popularity: 310.5, NowPlaying: true, ChangedAt: changed},
+			{ID: unknownTmdbID, Title: "Not In The Catalog", ChangedAt: changed},
+		},
+	})
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newClient(t *testing.T, baseURL, key string) *tmdb.Client {
+	t.Helper()
+	client, err := tmdb.New(tmdb.Config{APIKey: key, BaseURL: baseURL, Timeout: 5 * time.Second, RateLimit: 1000, Burst: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPickTargets(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, fakeTMDB(t), "test-token")
+
+	changed, listed, err := readFeeds(ctx, client, time.Now().Add(-48*time.Hour), time.Now(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(changed)
+	if want := []int{knownTmdbID, newTmdbID, unknownTmdbID}; !slices.Equal(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if want := []int{newTmdbID}; !slices.Equal(listed, want) {
+		t.Errorf("listed = %v, want %v", listed, want)
+	}
+
+	got := pickTargets(map[int]int{knownTmdbID: 7}, changed, listed)
+	want := []target{{ID: 0, TmdbID: newTmdbID}, {ID: 7, TmdbID: knownTmdbID}}
+	if !slices.Equal(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+}
+
+func TestReadFeedsUnauthorized(t *testing.T) {
+	bad := newClient(t, fakeTMDB(t), "wrong")
+	_, _, err := readFeeds(context.Background(), bad, time.Now().Add(-time.Hour), time.Now(), 1)
+	if !errors.Is(err, tmdb.ErrUnauthorized) {
+		t.Errorf("err = %v, want tmdb.ErrUnauthorized", err)
+	}
+}
+
+// TestRunIncremental needs a Postgres database with pgvector in
+// TEST_DATABASE_URL; the migrations are applied to it.
+func TestRunIncremental(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := database.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := migrations.Up(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM movies WHERE tmdb_id = ANY(ARRAY[$1, $2, $3]::int[])`,
+		knownTmdbID, newTmdbID, unknownTmdbID); err != nil {
+		t.Fatal(err)
+	}
+	var knownID int
+	if err := db.QueryRowContext(ctx, `INSERT INTO movies (tmdb_id, title) VALUES ($1, 'Toy Story') RETURNING id`,
+		knownTmdbID).Scan(&knownID); err != nil {
+		t.Fatal(err)
+	}
+
+	err = RunIncremental(ctx, db, IncrementalOptions{
+		Options: Options{Workers: 2, TMDB: newClient(t, fakeTMDB(t), "test-token")},
+		Since:   time.Now().Add(-48 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var titleTR string
+	if err := db.QueryRowContext(ctx, `SELECT title_tr FROM movies WHERE id = $1`, knownID).Scan(&titleTR); err != nil {
+		t.Fatal(err)
+	}
+	if titleTR != "Oyuncak Hikayesi" {
+		t.Errorf("changed movie title_tr = %q, want Oyuncak Hikayesi", titleTR)
+	}
+
+	var title, status string
+	err = db.QueryRowContext(ctx, `
+		SELECT m.title, s.status FROM movies m JOIN movie_sync_state s ON s.movie_id = m.id
+		WHERE m.tmdb_id = $1`, newTmdbID).Scan(&title, &status)
+	if err != nil {
+		t.Fatalf("new movie: %v", err)
+	}
+	if title != "A New Release" || status != "ok" {
+		t.Errorf("new movie = (%q, %q), want (A New Release, ok)", title, status)
+	}
+
+	err = db.QueryRowContext(ctx, `SELECT title FROM movies WHERE tmdb_id = $1`, unknownTmdbID).Scan(&title)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown changed movie was synced (err %v)", err)
+	}
+
+	cp, err := checkpoint(ctx, db, changesFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(cp) > time.Minute {
+		t.Errorf("checkpoint = %v, want the start of the run", cp)
+	}
+}
@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"movie-search-db/catalog"
+)
+
+// maxErrorLen caps the error text kept in movie_sync_state.
+const maxErrorLen = 500
+
+// Statuses of movie_sync_state. not_found is terminal: the movie was
+// deleted from TMDB and no run picks it up again.
+const (
+	statusFailed   = "failed"
+	statusNotFound = "not_found"
+)
+
+// selectMovies returns the movies a run has to sync: with OnlyFailed the
+// ones whose last attempt failed, otherwise every movie without a
+// successful sync in the last Freshness (all movies when it is 0). Movies
+// deleted from TMDB are never selected.
+func selectMovies(ctx context.Context, db *sql.DB, opts Options) ([]catalog.Ref, error) {
+	switch {
+	case opts.OnlyFailed:
+		return catalog.Refs(ctx, db, `id IN (SELECT movie_id FROM movie_sync_state WHERE status = 'failed')`)
+	case opts.Freshness > 0:
+		return catalog.Refs(ctx, db, `NOT EXISTS (
+			SELECT 1 FROM movie_sync_state s
+			WHERE s.movie_id = movies.id
+			  AND (s.status = 'not_found' OR s.last_synced_at > now() - make_interval(secs => $1)))`,
+			opts.Freshness.Seconds())
+	}
+	return catalog.Refs(ctx, db, `NOT EXISTS (
+		SELECT 1 FROM movie_sync_state s WHERE s.movie_id = movies.id AND s.status = 'not_found')`)
+}
+
+// markSynced records a successful sync. It runs in the transaction of the
+// movie update so the checkpoint and the data never disagree.
+func markSynced(ctx context.Context, tx *sql.Tx, movieID int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO movie_sync_state (movie_id, status, last_synced_at, last_attempt_at, attempts, error)
+		VALUES ($1, 'ok', now(), now(), 0, NULL)
+		ON CONFLICT (movie_id) DO UPDATE SET
+			status = 'ok', last_synced_at = now(), last_attempt_at = now(), attempts = 0, error = NULL`, movieID)
+	return err
+}
+
+// markFailed records a failed attempt with its error. status is
+// statusFailed or statusNotFound.
+func markFailed(ctx context.Context, db *sql.DB, movieID int, status string, syncErr error) error {
+	msg := syncErr.Error()
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen]
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO movie_sync_state (movie_id, status, last_attempt_at, attempts, error)
+		VALUES ($1, $2, now(), 1, $3)
+		ON CONFLICT (movie_id) DO UPDATE SET
+			status = EXCLUDED.status, last_attempt_at = now(),
+			attempts = movie_sync_state.attempts + 1, error = EXCLUDED.error`, movieID, status, msg)
+	return err
+}
+
+// stateCounts summarizes movie_sync_state.
+type stateCounts struct {
+	Movies   int
+	Fresh    int
+	Failed   int
+	NotFound int
+	Pending  int
+}
+
+// countState counts the movies synced within freshness, the ones whose
+// last attempt failed, the ones deleted from TMDB and the ones a normal run
+// would still pick up.
+func countState(ctx context.Context, db *sql.DB, freshness time.Duration) (stateCounts, error) {
+	var c stateCounts
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE s.status <> 'not_found' AND s.last_synced_at > now() - make_interval(secs => $1)),
+		       COUNT(*) FILTER (WHERE s.status = 'failed'),
+		       COUNT(*) FILTER (WHERE s.status = 'not_found')
+		FROM movies m
+		LEFT JOIN movie_sync_state s ON s.movie_id = m.id
+		WHERE m.tmdb_id IS NOT NULL`, freshness.Seconds()).Scan(&c.Movies, &c.Fresh, &c.Failed, &c.NotFound)
+	c.Pending = c.Movies - c.Fresh - c.NotFound
+	return c, err
+}
@@ -1,159 +1,151 @@
-package main
+// Package updater refreshes every movie from the TMDB API: Turkish texts,
+// poster, credits, keywords and the vote/popularity numbers.
+package updater
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
+	"log/slog"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"movie-search-db/catalog"
+	"movie-search-db/metrics"
+	"movie-search-db/pool"
+	"movie-search-db/tmdb"
 )
 
-const (
-	WorkerCount = 15
-	TMDBURL     = "https://api.themoviedb.org/3/movie/%d?api_key=%s&language=tr-TR&append_to_response=credits,keywords"
-)
-
-type TMDBFullResponse struct {
-	Title            string  `json:"title"`
-	Overview         string  `json:"overview"`
-	Tagline          string  `json:"tagline"`
-	PosterPath       *string `json:"poster_path"`
-	ReleaseDate      string  `json:"release_date"`
-	Popularity       float64 `json:"popularity"`
-	VoteAverage      float64 `json:"vote_average"`
-	VoteCount        int     `json:"vote_count"`
-	OriginalLanguage string  `json:"original_language"`
-	Genres           []struct {
-		ID   int    `json:"id"`
-		Name string `json:"name"`
-	} `json:"genres"`
-	Keywords struct {
-		Keywords []struct {
-			ID   int    `json:"id"`
-			Name string `json:"name"`
-		} `json:"keywords"`
-	} `json:"keywords"`
-	Credits struct {
-		Cast []struct {
-			Name      string `json:"name"`
-			Character string `json:"character"`
-			Order     int    `json:"order"`
-		} `json:"cast"`
-		Crew []struct {
-			Name string `json:"name"`
-			Job  string `json:"job"`
-		} `json:"crew"`
-	} `json:"credits"`
-}
-
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal(".env yuklenemedi")
-	}
+const DefaultWorkers = 15
+
+type Options struct {
+	Workers int
+	// TMDB is shared by all workers, it keeps them under the rate limit.
+	TMDB *tmdb.Client
+	// Freshness skips movies synced successfully within this window; 0
+	// syncs every movie.
+	Freshness time.Duration
+	// OnlyFailed retries just the movies whose last attempt failed.
+	OnlyFailed bool
 }
 
-func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
-
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
-
-	db.SetMaxOpenConns(WorkerCount + 5)
-	db.SetMaxIdleConns(WorkerCount)
+func Run(ctx context.Context, db *sql.DB, opts Options) error {
+	start := time.Now()
+	db.SetMaxOpenConns(opts.Workers + 5)
+	db.SetMaxIdleConns(opts.Workers)
 
-	if err := prepareDatabase(db); err != nil {
-		log.Fatalf("DB Hazirlik Hatasi: %v", err)
+	if st, err := countState(ctx, db, opts.Freshness); err != nil {
+		slog.Warn("sync state count failed", "stage", "select", "err", err)
+	} else {
+		slog.Info("sync state", "stage", "select", "total", st.Movies, "fresh", st.Fresh,
+			"failed", st.Failed, "not_found", st.NotFound, "pending", st.Pending, "freshness", opts.Freshness)
 	}
-
-	rows, err := db.Query("SELECT id, tmdb_id FROM movies WHERE tmdb_id IS NOT NULL ORDER BY popularity DESC")
+	movies, err := selectMovies(ctx, db, opts)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("listing movies: %w", err)
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
+	slog.Info("sync started", "stage", "select", "movies", len(movies), "workers", opts.Workers,
+		"only_failed", opts.OnlyFailed)
+
+	job := metrics.StartJob("sync")
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	err = pool.Run(ctx, opts.Workers, movies, func(ctx context.Context, m catalog.Ref) {
+		start := time.Now()
+		data, err := fetchMovie(ctx, opts.TMDB, m.TmdbID)
 		if err != nil {
-			fmt.Println(err)
+			fetchFailed(ctx, db, m, err, job, abort)
+			return
 		}
-	}(rows)
-
-	jobs := make(chan [2]int, 100)
-	var wg sync.WaitGroup
-
-	for i := 0; i < WorkerCount; i++ {
-		wg.Add(1)
-		go worker(db, jobs, &wg)
-	}
 
-	rowCount := 0
-	for rows.Next() {
-		var id, tmdbID int
-		if err := rows.Scan(&id, &tmdbID); err != nil {
-			continue
+		if err := saveMovie(ctx, db, m.ID, data); err != nil {
+			slog.Error("movie sync failed", "stage", "update", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+			recordFailure(ctx, db, m, err)
+			job.Failed(1)
+		} else {
+			slog.Info("movie synced", "movie_id", m.ID, "tmdb_id", m.TmdbID, "title", data.Title, "duration", time.Since(start))
+			job.OK(1)
 		}
-		jobs <- [2]int{id, tmdbID}
-		rowCount++
+	})
+	catalog.BumpIfChanged(ctx, db, "sync", job.Succeeded())
+	if err != nil {
+		return context.Cause(ctx)
 	}
 
-	fmt.Printf("%d film için güncelleme işlemi başlatıldı...\n", rowCount)
-	close(jobs)
-	wg.Wait()
-	fmt.Println("\nSenkronizasyon tamamlandı.")
+	job.Finish()
+	slog.Info("sync finished", "movies", len(movies), "duration", time.Since(start))
+	return job.Err()
 }
 
-func prepareDatabase(db *sql.DB) error {
-	query := `
-	ALTER TABLE movies ADD COLUMN IF NOT EXISTS genres JSONB;
-	ALTER TABLE movies ADD COLUMN IF NOT EXISTS keywords JSONB;
-	ALTER TABLE movies ADD COLUMN IF NOT EXISTS cast_list JSONB;
-	ALTER TABLE movies ADD COLUMN IF NOT EXISTS director TEXT;
-	`
-	_, err := db.Exec(query)
-	return err
+// fetchMovie returns the Turkish details of a movie with credits and
+// keywords.
+func fetchMovie(ctx context.Context, client *tmdb.Client, tmdbID int) (*tmdb.Movie, error) {
+	return client.Movie(ctx, tmdbID, "tr-TR", "credits", "keywords")
 }
 
-func worker(db *sql.DB, jobs <-chan [2]int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	client := &http.Client{Timeout: 15 * time.Second}
-	apiKey := os.Getenv("TMDB_API_KEY")
-
-	for job := range jobs {
-		dbID, tmdbID := job[0], job[1]
+// fetchFailed logs and records a failed TMDB request. Movies deleted from
+// TMDB count as skipped and are recorded as not_found so later runs leave
+// them alone; an auth failure aborts the run since no other request can
+// succeed.
+func fetchFailed(ctx context.Context, db *sql.DB, m catalog.Ref, err error, job *metrics.Job, abort context.CancelCauseFunc) {
+	switch {
+	case errors.Is(err, tmdb.ErrUnauthorized):
+		slog.Error("tmdb rejected the api key, stopping", "stage", "fetch", "tmdb_id", m.TmdbID, "err", err)
+		abort(err)
+		job.Failed(1)
+		return
+	case errors.Is(err, tmdb.ErrNotFound):
+		slog.Warn("movie not found on tmdb", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID)
+		job.Skipped(1)
+	default:
+		slog.Error("movie sync failed", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+		job.Failed(1)
+	}
+	if m.ID != 0 {
+		recordFailure(ctx, db, m, err)
+	}
+}
 
-		data, err := fetchTMDBData(client, tmdbID, apiKey)
-		if err != nil {
-			log.Printf("[Hata] TMDB ID %d: %v", tmdbID, err)
-			continue
-		}
+// recordFailure stores a failed attempt, as not_found when TMDB no longer
+// has the movie. Interrupted runs are not recorded, the movie is simply
+// picked up again by the next run.
+func recordFailure(ctx context.Context, db *sql.DB, m catalog.Ref, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	status := statusFailed
+	if errors.Is(err, tmdb.ErrNotFound) {
+		status = statusNotFound
+	}
+	if err := markFailed(ctx, db, m.ID, status, err); err != nil {
+		slog.Error("sync state write failed", "stage", "state", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+	}
+}
 
-		if err := performUpdate(db, dbID, data); err != nil {
-			log.Printf("[Hata] DB Update ID %d: %v", dbID, err)
-		} else {
-			fmt.Printf("[OK] %s guncellendi.\n", data.Title)
-		}
+// saveMovie updates the movie and its sync checkpoint in one transaction.
+func saveMovie(ctx context.Context, db *sql.DB, dbID int, data *tmdb.Movie) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
 
-		time.Sleep(40 * time.Millisecond)
+	if err := performUpdate(ctx, tx, dbID, data); err != nil {
+		return err
 	}
+	if err := markSynced(ctx, tx, dbID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func performUpdate(db *sql.DB, dbID int, data *TMDBFullResponse) error {
+// performUpdate writes the TMDB data of a movie. Movies whose embedded
+// text changed are marked with needs_embedding for the next embed run.
+func performUpdate(ctx context.Context, tx *sql.Tx, dbID int, data *tmdb.Movie) error {
 	var directors []string
 	for _, member := range data.Credits.Crew {
 		if member.Job == "Director" {
@@ -179,10 +171,16 @@ func performUpdate(db *sql.DB, dbID int, data *TMDBFullResponse) error {
 		    popularity = $10,
 		    vote_average = $11,
 		    vote_count = $12,
-		    original_language = $13
+		    original_language = $13,
+		    search_vector = movie_search_vector(title, $1, overview, $2, $7, $8),
+		    needs_embedding = embedding IS NOT NULL AND (needs_embedding
+		        OR title_tr IS DISTINCT FROM $1 OR overview_tr IS DISTINCT FROM $2
+		        OR tagline_tr IS DISTINCT FROM $3 OR director IS DISTINCT FROM $5
+		        OR genres IS DISTINCT FROM $6 OR keywords IS DISTINCT FROM $7
+		        OR cast_list IS DISTINCT FROM $8 OR release_date IS DISTINCT FROM NULLIF($9, '')::DATE)
 		WHERE id = $14`
 
-	_, err := db.Exec(query,
+	_, err := tx.ExecContext(ctx, query,
 		data.Title, data.Overview, data.Tagline, data.PosterPath,
 		strings.Join(directors, ", "),
 		genresJSON, keywordsJSON, castJSON,
@@ -191,27 +189,3 @@ func performUpdate(db *sql.DB, dbID int, data *TMDBFullResponse) error {
 	)
 	return err
 }
-
-func fetchTMDBData(client *http.Client, tmdbID int, apiKey string) (*TMDBFullResponse, error) {
-	url := fmt.Sprintf(TMDBURL, tmdbID, apiKey)
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	var res TMDBFullResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-	return &res, nil
-}
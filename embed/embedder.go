@@ -1,22 +1,28 @@
-package main
+// Package embed stores an embedding for every movie that has a Turkish
+// overview but no vector yet, or one marked stale by the sync.
+package embed
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"sync"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+
+	"movie-search-db/catalog"
+	"movie-search-db/embedding"
+	"movie-search-db/logging"
+	"movie-search-db/metrics"
+	"movie-search-db/pool"
 )
 
-const WorkerCount = 20
+const (
+	DefaultWorkerCount = 4
+	DefaultBatchSize   = 32
+)
 
 type MovieJob struct {
 	ID         int
@@ -34,28 +40,48 @@ type MovieJob struct {
 	VoteAvg    float64 // IMDB Puanı için eklendi
 }
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal(".env error")
-	}
+type Options struct {
+	Workers   int
+	BatchSize int
 }
 
-func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
+func Run(ctx context.Context, db *sql.DB, embedder embedding.Embedder, opts Options) error {
+	start := time.Now()
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if err := embedding.CheckColumn(ctx, db, embedder); err != nil {
+		return err
+	}
 
-	db, err := sql.Open("postgres", dsn)
+	movies, err := loadMovies(ctx, db)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("listing movies: %w", err)
 	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
+	var batches [][]MovieJob
+	for i := 0; i < len(movies); i += opts.BatchSize {
+		batches = append(batches, movies[i:min(i+opts.BatchSize, len(movies))])
+	}
+	slog.Info("embedding started", "movies", len(movies), "workers", opts.Workers,
+		"batch_size", opts.BatchSize, "model", embedder.Model())
+
+	job := metrics.StartJob("embed")
+	err = pool.Run(ctx, opts.Workers, batches, func(ctx context.Context, batch []MovieJob) {
+		processBatch(ctx, db, embedder, job, batch)
+	})
+	catalog.BumpIfChanged(ctx, db, "embed", job.Succeeded())
+	if err != nil {
+		return err
+	}
+
+	job.Finish()
+	slog.Info("embedding finished", "movies", len(movies), "duration", time.Since(start))
+	return job.Err()
+}
 
+// loadMovies reads the movies that still need an embedding or whose
+// embedding is stale after a sync.
+func loadMovies(ctx context.Context, db *sql.DB) ([]MovieJob, error) {
 	// Sorguya vote_average eklendi
 	query := `
        SELECT id, title, COALESCE(title_tr, '') as title_tr, 
@@ -66,60 +92,16 @@ func main() {
        COALESCE((SELECT string_agg(elem, ', ') FROM jsonb_array_elements_text(CASE WHEN jsonb_typeof(keywords) = 'array' THEN keywords ELSE '[]'::jsonb END) elem), '') as keywords_list,
        COALESCE((SELECT string_agg(elem, ', ') FROM jsonb_array_elements_text(CASE WHEN jsonb_typeof(cast_list) = 'array' THEN cast_list ELSE '[]'::jsonb END) elem), '') as cast_list_text
        FROM movies 
-       WHERE embedding IS NULL AND overview_tr IS NOT NULL
+       WHERE (embedding IS NULL OR needs_embedding) AND overview_tr IS NOT NULL
     `
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(rows)
-
-	jobs := make(chan MovieJob, 100)
-	var wg sync.WaitGroup
-
-	for i := 0; i < WorkerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			client := &http.Client{Timeout: 60 * time.Second}
-			for j := range jobs {
-				// SAYISAL VERİLERİ ANLAMSAL METNE DÖNÜŞTÜRME
-				// Hem İngilizce hem Türkçe terimlerle modeli besliyoruz
-				combinedText := fmt.Sprintf(
-					"Represent this movie for retrieval: "+
-						"Titles: [EN: %s | TR: %s]. "+
-						"Rating: %.1f/10. IMDB Score: %.1f. Release Year: %s. "+ // EN Sayısal Bağlam
-						"IMDB Puanı: %.1f/10. Çıkış Yılı: %s. "+ // TR Sayısal Bağlam
-						"Director: %s. Metadata: {Genres: %s. Keywords: %s. Cast: %s}. "+
-						"EN_Context: %s %s. TR_Baglam: %s %s.",
-					j.Title, j.TitleTR,
-					j.VoteAvg, j.VoteAvg, j.Year,
-					j.VoteAvg, j.Year,
-					j.Director, j.Genres, j.Keywords, j.Cast,
-					j.Tagline, j.Overview, j.TaglineTR, j.OverviewTR,
-				)
-
-				emb, err := getEmbedding(combinedText, client)
-				if err != nil {
-					log.Printf("ID %d Error: %v", j.ID, err)
-					continue
-				}
-
-				embJSON, _ := json.Marshal(emb)
-				_, err = db.Exec("UPDATE movies SET embedding = $1 WHERE id = $2", string(embJSON), j.ID)
-				if err == nil {
-					fmt.Printf("Vektör Kaydedildi: %d | %s | Puan: %.1f\n", j.ID, j.Title, j.VoteAvg)
-				}
-			}
-		}()
+		return nil, err
 	}
+	defer logging.CloseQuietly(rows)
 
+	var movies []MovieJob
 	for rows.Next() {
 		var j MovieJob
 		var t, ttr, tg, tgtr, ov, ovtr, dir, rd, gn, kw, cs sql.NullString
@@ -137,34 +119,76 @@ func main() {
 		}
 		j.VoteAvg = vavg.Float64
 		j.Genres, j.Keywords, j.Cast = gn.String, kw.String, cs.String
-		jobs <- j
+		movies = append(movies, j)
 	}
+	return movies, rows.Err()
+}
 
-	close(jobs)
-	wg.Wait()
+// Document builds the text that gets embedded for a movie.
+func (j MovieJob) Document() string {
+	// SAYISAL VERİLERİ ANLAMSAL METNE DÖNÜŞTÜRME
+	// Hem İngilizce hem Türkçe terimlerle modeli besliyoruz
+	return fmt.Sprintf(
+		"Represent this movie for retrieval: "+
+			"Titles: [EN: %s | TR: %s]. "+
+			"Rating: %.1f/10. IMDB Score: %.1f. Release Year: %s. "+ // EN Sayısal Bağlam
+			"IMDB Puanı: %.1f/10. Çıkış Yılı: %s. "+ // TR Sayısal Bağlam
+			"Director: %s. Metadata: {Genres: %s. Keywords: %s. Cast: %s}. "+
+			"EN_Context: %s %s. TR_Baglam: %s %s.",
+		j.Title, j.TitleTR,
+		j.VoteAvg, j.VoteAvg, j.Year,
+		j.VoteAvg, j.Year,
+		j.Director, j.Genres, j.Keywords, j.Cast,
+		j.Tagline, j.Overview, j.TaglineTR, j.OverviewTR,
+	)
 }
 
-func getEmbedding(input string, client *http.Client) ([]float32, error) {
-	url := fmt.Sprintf("%s/api/embed", os.Getenv("OLLAMA_BASE_URL"))
-	body, _ := json.Marshal(map[string]string{"model": "bge-m3", "input": input})
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// processBatch embeds the whole batch in one request and stores the vectors
+// with one UPDATE. If either step fails the batch is retried item by item so
+// a single bad movie does not drop the rest of the batch.
+func processBatch(ctx context.Context, db *sql.DB, embedder embedding.Embedder, job *metrics.Job, batch []MovieJob) {
+	start := time.Now()
+
+	docs := make([]string, len(batch))
+	for i, j := range batch {
+		docs[i] = j.Document()
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
+
+	vecs, err := embedder.Embed(ctx, docs)
+	if err == nil {
+		err = saveEmbeddings(ctx, db, batch, vecs)
+		if err == nil {
+			slog.Info("embeddings saved", "movies", len(batch), "first_movie_id", batch[0].ID,
+				"last_movie_id", batch[len(batch)-1].ID, "duration", time.Since(start))
+			job.OK(len(batch))
+			return
 		}
-	}(resp.Body)
+	}
+	if len(batch) == 1 {
+		slog.Error("embedding failed", "stage", "embed", "movie_id", batch[0].ID, "err", err)
+		job.Failed(1)
+		return
+	}
 
-	var res struct {
-		Embeddings [][]float32 `json:"embeddings"`
+	slog.Warn("batch failed, retrying movies one by one", "stage", "embed", "movies", len(batch), "err", err)
+	for _, j := range batch {
+		processBatch(ctx, db, embedder, job, []MovieJob{j})
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
+}
+
+func saveEmbeddings(ctx context.Context, db *sql.DB, batch []MovieJob, vecs [][]float32) error {
+	ids := make([]int64, len(batch))
+	embs := make([]string, len(batch))
+	for i, j := range batch {
+		ids[i] = int64(j.ID)
+		embJSON, _ := json.Marshal(vecs[i])
+		embs[i] = string(embJSON)
 	}
-	return res.Embeddings[0], nil
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE movies m
+		SET embedding = v.embedding::vector, needs_embedding = FALSE
+		FROM unnest($1::int[], $2::text[]) AS v(id, embedding)
+		WHERE m.id = v.id`, pq.Array(ids), pq.Array(embs))
+	return err
 }
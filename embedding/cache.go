@@ -0,0 +1,161 @@
+package embedding
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"movie-search-db/lru"
+)
+
+// Cached puts an LRU cache with TTL, and optionally a Postgres table, in
+// front of another Embedder. Keys are the normalized input plus the model
+// name, so switching models never serves stale vectors.
+type Cached struct {
+	inner   Embedder
+	persist *PostgresCache
+	lru     *lru.Cache[[]float32]
+
+	hits, persistentHits, misses atomic.Int64
+}
+
+type CacheStats struct {
+	Hits           int64 `json:"hits"`
+	PersistentHits int64 `json:"persistent_hits"`
+	Misses         int64 `json:"misses"`
+	Evictions      int64 `json:"evictions"`
+	Entries        int   `json:"entries"`
+}
+
+// NewCached wraps inner. persist may be nil to keep the cache in memory.
+func NewCached(inner Embedder, size int, ttl time.Duration, persist *PostgresCache) *Cached {
+	return &Cached{inner: inner, persist: persist, lru: lru.New[[]float32](size, ttl)}
+}
+
+func (c *Cached) Model() string  { return c.inner.Model() }
+func (c *Cached) Dimension() int { return c.inner.Dimension() }
+
+// NormalizeQuery trims, lowercases and collapses whitespace.
+func NormalizeQuery(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func (c *Cached) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	out := make([][]float32, len(inputs))
+	var missIdx []int
+	var missText []string
+
+	for i, in := range inputs {
+		norm := NormalizeQuery(in)
+		if vec, ok := c.lru.Get(c.key(norm)); ok {
+			c.hits.Add(1)
+			out[i] = vec
+			continue
+		}
+		if c.persist != nil {
+			vec, err := c.persist.Get(ctx, c.Model(), norm)
+			if err == nil && len(vec) == c.Dimension() {
+				c.persistentHits.Add(1)
+				c.lru.Put(c.key(norm), vec)
+				out[i] = vec
+				continue
+			}
+		}
+		c.misses.Add(1)
+		missIdx = append(missIdx, i)
+		missText = append(missText, norm)
+	}
+
+	if len(missText) == 0 {
+		return out, nil
+	}
+	vecs, err := c.inner.Embed(ctx, missText)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missIdx {
+		out[i] = vecs[j]
+		c.lru.Put(c.key(missText[j]), vecs[j])
+		if c.persist != nil {
+			// the persistent tier is best effort
+			_ = c.persist.Put(ctx, c.Model(), missText[j], vecs[j])
+		}
+	}
+	return out, nil
+}
+
+func (c *Cached) Stats() CacheStats {
+	return CacheStats{
+		Hits:           c.hits.Load(),
+		PersistentHits: c.persistentHits.Load(),
+		Misses:         c.misses.Load(),
+		Evictions:      c.lru.Evictions(),
+		Entries:        c.lru.Len(),
+	}
+}
+
+func (c *Cached) key(norm string) string {
+	return c.Model() + "\x00" + norm
+}
+
+// PostgresCache stores query embeddings in query_embeddings so the cache
+// survives restarts. Rows unused for longer than ttl are not served and
+// are deleted by Prune.
+type PostgresCache struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewPostgresCache(db *sql.DB, ttl time.Duration) *PostgresCache {
+	return &PostgresCache{db: db, ttl: ttl}
+}
+
+func (p *PostgresCache) Get(ctx context.Context, model, query string) ([]float32, error) {
+	var raw string
+	err := p.db.QueryRowContext(ctx, `
+		UPDATE query_embeddings SET last_used_at = now()
+		WHERE model = $1 AND query = $2 AND last_used_at >= now() - make_interval(secs => $3)
+		RETURNING embedding::text`, model, query, p.ttl.Seconds()).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vec []float32
+	err = json.Unmarshal([]byte(raw), &vec)
+	return vec, err
+}
+
+func (p *PostgresCache) Put(ctx context.Context, model, query string, vec []float32) error {
+	embJSON, _ := json.Marshal(vec)
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO query_embeddings (model, query, embedding)
+		VALUES ($1, $2, $3::vector)
+		ON CONFLICT (model, query) DO UPDATE SET embedding = EXCLUDED.embedding, last_used_at = now()`,
+		model, query, string(embJSON))
+	return err
+}
+
+// Prune deletes the rows unused for longer than the TTL.
+func (p *PostgresCache) Prune(ctx context.Context) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM query_embeddings WHERE last_used_at < now() - make_interval(secs => $1)`,
+		p.ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Invalidate drops the vectors of every model except the current one.
+func (p *PostgresCache) Invalidate(ctx context.Context, currentModel string) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM query_embeddings WHERE model <> $1`, currentModel)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,144 @@
+// Package embedding turns text into vectors for the movies.embedding column.
+// The API server embeds search queries and the embed worker embeds movie
+// documents through the same Embedder so both sides always agree on the
+// model and the vector size.
+package embedding
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ColumnDimension is the size of the movies.embedding vector column.
+const ColumnDimension = 1024
+
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+
+	DefaultModel = "bge-m3"
+)
+
+// KnownDimensions lists the output size of models we have used. Models not
+// listed here are trusted to return EMBEDDING_DIMENSION sized vectors.
+var KnownDimensions = map[string]int{
+	"bge-m3":                         1024,
+	"mxbai-embed-large":              1024,
+	"nomic-embed-text":               768,
+	"all-minilm":                     384,
+	"text-embedding-3-small":         1536,
+	"text-embedding-3-large":         3072,
+	"text-embedding-ada-002":         1536,
+	"intfloat/multilingual-e5-large": 1024,
+}
+
+var ErrEmptyEmbedding = errors.New("empty_embedding")
+
+type Embedder interface {
+	// Embed returns one vector per input, in input order.
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+	Model() string
+	Dimension() int
+}
+
+// Pinger is implemented by providers that can check the model is available
+// without embedding anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that e can serve requests. Providers that do not implement
+// Pinger are assumed to be available.
+func Ping(ctx context.Context, e Embedder) error {
+	if p, ok := e.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+type Config struct {
+	Provider  string
+	Model     string
+	Dimension int
+	BaseURL   string
+	APIKey    string
+	Timeout   time.Duration
+}
+
+func (c Config) Validate() error {
+	if c.Model == "" {
+		return errors.New("embedding model is empty")
+	}
+	if want, ok := KnownDimensions[c.Model]; ok && want != c.Dimension {
+		return fmt.Errorf("model %s produces %d dimensional vectors, configured dimension is %d", c.Model, want, c.Dimension)
+	}
+	if c.Dimension != ColumnDimension {
+		return fmt.Errorf("embedding dimension %d does not match movies.embedding vector(%d)", c.Dimension, ColumnDimension)
+	}
+	if c.Provider != ProviderFake && c.BaseURL == "" {
+		return fmt.Errorf("base url for embedding provider %s is empty", c.Provider)
+	}
+	return nil
+}
+
+func New(cfg Config) (Embedder, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Provider {
+	case ProviderOllama:
+		return NewOllama(client, cfg.BaseURL, cfg.Model, cfg.Dimension), nil
+	case ProviderOpenAI:
+		return NewOpenAI(client, cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.Dimension), nil
+	case ProviderFake:
+		return NewFake(cfg.Model, cfg.Dimension), nil
+	}
+	return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+}
+
+// One embeds a single text.
+func One(ctx context.Context, e Embedder, text string) ([]float32, error) {
+	vecs, err := e.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// CheckColumn verifies that movies.embedding exists with the dimension the
+// embedder produces. pgvector stores the dimension in atttypmod.
+func CheckColumn(ctx context.Context, db *sql.DB, e Embedder) error {
+	var dim int
+	err := db.QueryRowContext(ctx, `
+		SELECT atttypmod FROM pg_attribute
+		WHERE attrelid = 'movies'::regclass AND attname = 'embedding' AND NOT attisdropped`).Scan(&dim)
+	if err != nil {
+		return fmt.Errorf("movies.embedding column lookup: %w", err)
+	}
+	if dim != e.Dimension() {
+		return fmt.Errorf("movies.embedding is vector(%d) but model %s produces %d dimensions", dim, e.Model(), e.Dimension())
+	}
+	return nil
+}
+
+func checkVectors(vecs [][]float32, n, dim int) error {
+	if len(vecs) != n {
+		return fmt.Errorf("expected %d embeddings, got %d", n, len(vecs))
+	}
+	for _, v := range vecs {
+		if len(v) == 0 {
+			return ErrEmptyEmbedding
+		}
+		if len(v) != dim {
+			return fmt.Errorf("expected %d dimensions, got %d", dim, len(v))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+)
+
+// Fake derives a unit vector from the hash of each input. The same text
+// always maps to the same vector, which is enough to run the API and the
+// embed worker without a model server.
+type Fake struct {
+	model string
+	dim   int
+}
+
+func NewFake(model string, dim int) *Fake {
+	return &Fake{model: model, dim: dim}
+}
+
+func (f *Fake) Model() string  { return f.model }
+func (f *Fake) Dimension() int { return f.dim }
+
+func (f *Fake) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	vecs := make([][]float32, len(inputs))
+	for i, in := range inputs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(in))
+		rng := rand.New(rand.NewPCG(h.Sum64(), uint64(f.dim)))
+
+		v := make([]float32, f.dim)
+		var norm float64
+		for j := range v {
+			x := rng.NormFloat64()
+			v[j] = float32(x)
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		for j := range v {
+			v[j] = float32(float64(v[j]) / norm)
+		}
+		vecs[i] = v
+	}
+	return vecs, nil
+}
@@ -0,0 +1,89 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"movie-search-db/logging"
+)
+
+// Ollama talks to the /api/embed endpoint, which accepts an array input.
+type Ollama struct {
+	client  *http.Client
+	baseURL string
+	model   string
+	dim     int
+}
+
+func NewOllama(client *http.Client, baseURL, model string, dim int) *Ollama {
+	return &Ollama{client: client, baseURL: strings.TrimRight(baseURL, "/"), model: model, dim: dim}
+}
+
+func (o *Ollama) Model() string  { return o.model }
+func (o *Ollama) Dimension() int { return o.dim }
+
+func (o *Ollama) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	body, _ := json.Marshal(map[string]any{"model": o.model, "input": inputs})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama_status_%d", resp.StatusCode)
+	}
+
+	var res struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if err := checkVectors(res.Embeddings, len(inputs), o.dim); err != nil {
+		return nil, err
+	}
+	return res.Embeddings, nil
+}
+
+// Ping checks that Ollama is reachable and the model has been pulled.
+func (o *Ollama) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama_status_%d", resp.StatusCode)
+	}
+
+	var res struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	for _, m := range res.Models {
+		if m.Name == o.model || m.Name == o.model+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("ollama model %s is not pulled", o.model)
+}
@@ -0,0 +1,94 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"movie-search-db/logging"
+)
+
+// OpenAI talks to any server implementing the OpenAI /v1/embeddings API
+// (OpenAI itself, vLLM, LocalAI, text-embeddings-inference, ...).
+type OpenAI struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	model   string
+	dim     int
+}
+
+func NewOpenAI(client *http.Client, baseURL, apiKey, model string, dim int) *OpenAI {
+	return &OpenAI{client: client, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, dim: dim}
+}
+
+func (o *OpenAI) Model() string  { return o.model }
+func (o *OpenAI) Dimension() int { return o.dim }
+
+func (o *OpenAI) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	body, _ := json.Marshal(map[string]any{"model": o.model, "input": inputs, "encoding_format": "float"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openai_status_%d", resp.StatusCode)
+	}
+
+	var res struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	vecs := make([][]float32, len(inputs))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	if err := checkVectors(vecs, len(inputs), o.dim); err != nil {
+		return nil, err
+	}
+	return vecs, nil
+}
+
+// Ping checks that the server knows the model.
+func (o *OpenAI) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/v1/models/"+o.model, nil)
+	if err != nil {
+		return err
+	}
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai_status_%d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	MaxGenreFilters = 10
+	MinFilterYear   = 1870
+)
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+type SearchFilters struct {
+	Genres       []string `json:"genres" query:"genres"`
+	YearFrom     *int     `json:"yearFrom" query:"yearFrom"`
+	YearTo       *int     `json:"yearTo" query:"yearTo"`
+	MinVote      *float64 `json:"minVote" query:"minVote"`
+	MinVoteCount *int     `json:"minVoteCount" query:"minVoteCount"`
+	Language     string   `json:"language" query:"language"`
+	Director     string   `json:"director" query:"director"`
+}
+
+type FilterError struct {
+	Field   string
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Normalize trims and lowercases the free-text filters so that the same
+// filter always produces the same SQL arguments.
+func (f *SearchFilters) Normalize() {
+	genres := make([]string, 0, len(f.Genres))
+	for _, g := range f.Genres {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g != "" {
+			genres = append(genres, g)
+		}
+	}
+	f.Genres = genres
+	f.Language = strings.ToLower(strings.TrimSpace(f.Language))
+	f.Director = strings.TrimSpace(f.Director)
+}
+
+func (f *SearchFilters) Validate() *FilterError {
+	if len(f.Genres) > MaxGenreFilters {
+		return &FilterError{"filters.genres", fmt.Sprintf("at most %d genres allowed", MaxGenreFilters)}
+	}
+
+	maxYear := time.Now().Year() + 5
+	if f.YearFrom != nil && (*f.YearFrom < MinFilterYear || *f.YearFrom > maxYear) {
+		return &FilterError{"filters.yearFrom", fmt.Sprintf("must be between %d and %d", MinFilterYear, maxYear)}
+	}
+	if f.YearTo != nil && (*f.YearTo < MinFilterYear || *f.YearTo > maxYear) {
+		return &FilterError{"filters.yearTo", fmt.Sprintf("must be between %d and %d", MinFilterYear, maxYear)}
+	}
+	if f.YearFrom != nil && f.YearTo != nil && *f.YearFrom > *f.YearTo {
+		return &FilterError{"filters.yearTo", "must not be before yearFrom"}
+	}
+
+	if f.MinVote != nil && (*f.MinVote < 0 || *f.MinVote > 10) {
+		return &FilterError{"filters.minVote", "must be between 0 and 10"}
+	}
+	if f.MinVoteCount != nil && *f.MinVoteCount < 0 {
+		return &FilterError{"filters.minVoteCount", "must not be negative"}
+	}
+
+	if f.Language != "" && !languagePattern.MatchString(f.Language) {
+		return &FilterError{"filters.language", "must be a two letter ISO 639-1 code"}
+	}
+	if len(f.Director) > 200 {
+		return &FilterError{"filters.director", "too long"}
+	}
+	return nil
+}
+
+// SQL returns the extra WHERE conditions for the filters. Placeholders are
+// numbered starting after the argN arguments the caller already bound.
+func (f *SearchFilters) SQL(argN int) (string, []any) {
+	var conds []string
+	var args []any
+
+	next := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", argN+len(args))
+	}
+
+	if len(f.Genres) > 0 {
+		conds = append(conds, fmt.Sprintf(`EXISTS (
+          SELECT 1 FROM jsonb_array_elements(CASE WHEN jsonb_typeof(genres) = 'array' THEN genres ELSE '[]'::jsonb END) g
+          WHERE LOWER(g->>'name') = ANY(%s))`, next(pq.Array(f.Genres))))
+	}
+	if f.YearFrom != nil {
+		conds = append(conds, fmt.Sprintf("release_date >= make_date(%s, 1, 1)", next(*f.YearFrom)))
+	}
+	if f.YearTo != nil {
+		conds = append(conds, fmt.Sprintf("release_date < make_date(%s, 1, 1)", next(*f.YearTo+1)))
+	}
+	if f.MinVote != nil {
+		conds = append(conds, fmt.Sprintf("vote_average >= %s", next(*f.MinVote)))
+	}
+	if f.MinVoteCount != nil {
+		conds = append(conds, fmt.Sprintf("vote_count >= %s", next(*f.MinVoteCount)))
+	}
+	if f.Language != "" {
+		conds = append(conds, fmt.Sprintf("original_language = %s", next(f.Language)))
+	}
+	if f.Director != "" {
+		conds = append(conds, fmt.Sprintf(`director ILIKE '%%' || %s || '%%' ESCAPE '\'`, next(escapeLike(f.Director))))
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "\n      AND " + strings.Join(conds, "\n      AND "), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func intPtr(v int) *int           { return &v }
+func floatPtr(v float64) *float64 { return &v }
+func genres(n int) (list []string) {
+	for range n {
+		list = append(list, "drama")
+	}
+	return list
+}
+
+func TestSearchFiltersValidate(t *testing.T) {
+	maxYear := time.Now().Year() + 5
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		field   string // empty when valid
+	}{
+		{"empty", SearchFilters{}, ""},
+		{"all set", SearchFilters{Genres: []string{"drama"}, YearFrom: intPtr(1990), YearTo: intPtr(2000),
+			MinVote: floatPtr(7), MinVoteCount: intPtr(100), Language: "en", Director: "Nolan"}, ""},
+		{"max genres", SearchFilters{Genres: genres(MaxGenreFilters)}, ""},
+		{"too many genres", SearchFilters{Genres: genres(MaxGenreFilters + 1)}, "filters.genres"},
+		{"year bounds", SearchFilters{YearFrom: intPtr(MinFilterYear), YearTo: intPtr(maxYear)}, ""},
+		{"yearFrom too early", SearchFilters{YearFrom: intPtr(MinFilterYear - 1)}, "filters.yearFrom"},
+		{"yearFrom too late", SearchFilters{YearFrom: intPtr(maxYear + 1)}, "filters.yearFrom"},
+		{"yearTo too early", SearchFilters{YearTo: intPtr(1000)}, "filters.yearTo"},
+		{"yearTo too late", SearchFilters{YearTo: intPtr(maxYear + 1)}, "filters.yearTo"},
+		{"same year", SearchFilters{YearFrom: intPtr(2000), YearTo: intPtr(2000)}, ""},
+		{"reversed years", SearchFilters{YearFrom: intPtr(2001), YearTo: intPtr(2000)}, "filters.yearTo"},
+		{"minVote bounds", SearchFilters{MinVote: floatPtr(10)}, ""},
+		{"negative minVote", SearchFilters{MinVote: floatPtr(-0.1)}, "filters.minVote"},
+		{"minVote above 10", SearchFilters{MinVote: floatPtr(10.5)}, "filters.minVote"},
+		{"zero minVoteCount", SearchFilters{MinVoteCount: intPtr(0)}, ""},
+		{"negative minVoteCount", SearchFilters{MinVoteCount: intPtr(-1)}, "filters.minVoteCount"},
+		{"three letter language", SearchFilters{Language: "eng"}, "filters.language"},
+		{"uppercase language", SearchFilters{Language: "EN"}, "filters.language"},
+		{"director too long", SearchFilters{Director: strings.Repeat("a", 201)}, "filters.director"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filters.Validate()
+			switch {
+			case tt.field == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.field != "" && err == nil:
+				t.Errorf("Validate() = nil, want error for %s", tt.field)
+			case tt.field != "" && err.Field != tt.field:
+				t.Errorf("Validate() field = %s, want %s", err.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestSearchFiltersNormalize(t *testing.T) {
+	f := SearchFilters{Genres: []string{" Drama ", "", "  ", "SCI-FI"}, Language: " EN ", Director: "  Nolan "}
+	f.Normalize()
+	want := SearchFilters{Genres: []string{"drama", "sci-fi"}, Language: "en", Director: "Nolan"}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("Normalize() = %+v, want %+v", f, want)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("normalized filters invalid: %v", err)
+	}
+}
+
+func TestSearchFiltersSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		argN    int
+		conds   []string
+		args    []any
+	}{
+		{"none", SearchFilters{}, 3, nil, nil},
+		{"genres", SearchFilters{Genres: []string{"drama", "comedy"}}, 1,
+			[]string{"LOWER(g->>'name') = ANY($2))"}, []any{pq.Array([]string{"drama", "comedy"})}},
+		{"yearFrom", SearchFilters{YearFrom: intPtr(1990)}, 0,
+			[]string{"release_date >= make_date($1, 1, 1)"}, []any{1990}},
+		{"yearTo is exclusive next year", SearchFilters{YearTo: intPtr(1999)}, 0,
+			[]string{"release_date < make_date($1, 1, 1)"}, []any{2000}},
+		{"minVote", SearchFilters{MinVote: floatPtr(7.5)}, 4,
+			[]string{"vote_average >= $5"}, []any{7.5}},
+		{"minVoteCount", SearchFilters{MinVoteCount: intPtr(50)}, 4,
+			[]string{"vote_count >= $5"}, []any{50}},
+		{"language", SearchFilters{Language: "tr"}, 2,
+			[]string{"original_language = $3"}, []any{"tr"}},
+		{"director escapes like", SearchFilters{Director: `50%_off\`}, 2,
+			[]string{`director ILIKE '%' || $3 || '%' ESCAPE '\'`}, []any{`50\%\_off\\`}},
+		{"all in order", SearchFilters{Genres: []string{"drama"}, YearFrom: intPtr(1990), YearTo: intPtr(2000),
+			MinVote: floatPtr(7), MinVoteCount: intPtr(100), Language: "en", Director: "Nolan"}, 1,
+			[]string{"ANY($2))", "make_date($3, 1, 1)", "make_date($4, 1, 1)", "vote_average >= $5",
+				"vote_count >= $6", "original_language = $7", "|| $8 ||"},
+			[]any{pq.Array([]string{"drama"}), 1990, 2001, 7.0, 100, "en", "Nolan"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.filters.SQL(tt.argN)
+			if len(tt.conds) == 0 {
+				if sql != "" || args != nil {
+					t.Errorf("SQL() = %q, %v, want no conditions", sql, args)
+				}
+				return
+			}
+			if !strings.HasPrefix(sql, "\n      AND ") {
+				t.Errorf("SQL() = %q, want it to start with AND", sql)
+			}
+			last := 0
+			for _, c := range tt.conds {
+				i := strings.Index(sql[last:], c)
+				if i < 0 {
+					t.Errorf("SQL() = %q, want %q after offset %d", sql, c, last)
+					continue
+				}
+				last += i + len(c)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("SQL() args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseSearchOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		limit   int
+		cursor  string
+		profile string
+		code    string
+		field   string
+	}{
+		{"filter", SearchFilters{Language: "english"}, 0, "", "", "invalid_filter", "filters.language"},
+		{"limit", SearchFilters{}, -1, "", "", "invalid_limit", ""},
+		{"cursor", SearchFilters{}, 0, "not a cursor", "", "invalid_cursor", ""},
+		{"profile", SearchFilters{}, 0, "", "no-such-profile", "unknown_profile", "profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, body := parseSearchOptions(&tt.filters, tt.limit, tt.cursor, tt.profile)
+			if body == nil {
+				t.Fatal("parseSearchOptions() accepted invalid input")
+			}
+			if body["error"] != tt.code {
+				t.Errorf("error = %v, want %s", body["error"], tt.code)
+			}
+			if tt.field != "" && body["field"] != tt.field {
+				t.Errorf("field = %v, want %s", body["field"], tt.field)
+			}
+		})
+	}
+}
@@ -1,5 +1,5 @@
 import axios from 'axios';
-import type { Movie } from './types/schema.ts';
+import type { Movie, SearchResponse } from './types/schema.ts';
 
 const api = axios.create({
     baseURL: 'https://searchapi.miktatmert.dev/api',
@@ -7,6 +7,6 @@ const api = axios.create({
 
 export const fetchMovies = async (query: string, captchaToken: string): Promise<Movie[]> => {
     if (!query) return [];
-    const { data } = await api.post<Movie[]>('/search', { query, captchaToken });
-    return data;
+    const { data } = await api.post<SearchResponse>('/search', { query, captchaToken });
+    return data.results;
 };
\ No newline at end of file
@@ -15,4 +15,11 @@ export interface Movie {
     Post: string;
     Vote: number;
     Sim: number;
+}
+
+export interface SearchResponse {
+    results: Movie[];
+    nextCursor: string | null;
+    total: number;
+    limit: number;
 }
\ No newline at end of file
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/catalog"
+	"movie-search-db/embedding"
+	"movie-search-db/migrations"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// embeddingProvider is the provider without the query cache in front of it,
+// so the readiness check really reaches the model server.
+var embeddingProvider embedding.Embedder
+
+// catalogCounts holds catalog.Count for one catalog version. The counts
+// only change when a batch job bumps the version, so probes do not scan
+// movies every time.
+var catalogCounts struct {
+	mu      sync.Mutex
+	version int64
+	counts  *catalog.Counts
+}
+
+func cachedCounts(ctx context.Context) (catalog.Counts, error) {
+	st, err := catalog.Current(ctx, db)
+	if err != nil {
+		return catalog.Counts{}, err
+	}
+	catalogCounts.mu.Lock()
+	defer catalogCounts.mu.Unlock()
+	if catalogCounts.counts != nil && catalogCounts.version == st.Version {
+		return *catalogCounts.counts, nil
+	}
+	counts, err := catalog.Count(ctx, db)
+	if err != nil {
+		return counts, err
+	}
+	catalogCounts.version, catalogCounts.counts = st.Version, &counts
+	return counts, nil
+}
+
+type checkResult struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Detail any    `json:"detail,omitempty"`
+}
+
+// handleHealthz only tells that the process is serving requests.
+func handleHealthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// handleReadyz checks the database, the embedding model and that enough
+// movies are embedded (READY_MIN_EMBEDDED_RATIO). The ratio counts only the
+// movies with a Turkish overview: the others are never embedded. It returns
+// 503 when any check fails so load balancers stop routing traffic to the
+// instance. The container healthcheck uses /healthz instead: an unreachable
+// model host makes the instance unready, not broken.
+func handleReadyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), cfg.Server.ReadyTimeout)
+	defer cancel()
+
+	checks := map[string]checkResult{}
+	ready := true
+	record := func(name string, r checkResult) {
+		checks[name] = r
+		ready = ready && r.OK
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		record("database", checkResult{Error: err.Error()})
+	} else {
+		record("database", checkResult{OK: true})
+	}
+
+	if err := embedding.Ping(ctx, embeddingProvider); err != nil {
+		record("embedding", checkResult{Error: err.Error(), Detail: embeddingProvider.Model()})
+	} else {
+		record("embedding", checkResult{OK: true, Detail: embeddingProvider.Model()})
+	}
+
+	counts, err := cachedCounts(ctx)
+	if err != nil {
+		record("embedded_movies", checkResult{Error: err.Error()})
+	} else {
+		minRatio := cfg.Server.ReadyMinEmbeddedRatio
+		ratio := 0.0
+		if counts.Translated > 0 {
+			ratio = float64(counts.Embedded) / float64(counts.Translated)
+		}
+		r := checkResult{OK: counts.Translated > 0 && ratio >= minRatio, Detail: fiber.Map{"ratio": ratio, "min": minRatio}}
+		if !r.OK {
+			r.Error = "too few movies embedded"
+		}
+		record("embedded_movies", r)
+	}
+
+	status := "ready"
+	if !ready {
+		status = "not_ready"
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: version}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.GoVersion = info.GoVersion
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.BuildTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// handleVersion reports the build, the schema and embedding model in use
+// and the size of the catalog.
+func handleVersion(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	schema := fiber.Map{"expected": migrations.Latest()}
+	if v, err := migrations.Version(ctx, db); err == nil {
+		schema["current"] = v
+	}
+	resp := fiber.Map{
+		"build":  readBuildInfo(),
+		"schema": schema,
+		"embedding": fiber.Map{
+			"model":     embeddingProvider.Model(),
+			"dimension": embeddingProvider.Dimension(),
+		},
+	}
+	if st, err := catalog.Current(ctx, db); err == nil {
+		resp["catalog"] = fiber.Map{"version": st.Version, "updatedAt": st.UpdatedAt, "updatedBy": st.UpdatedBy}
+	}
+	if counts, err := cachedCounts(ctx); err == nil {
+		resp["counts"] = counts
+	}
+	return c.JSON(resp)
+}
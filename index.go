@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"movie-search-db/logging"
+)
+
+type indexOptions struct {
+	Type               string
+	M                  int
+	EfConstruction     int
+	Lists              int
+	MaintenanceWorkMem string
+}
+
+func indexFlags(fs *flag.FlagSet) *indexOptions {
+	var opts indexOptions
+	fs.StringVar(&opts.Type, "type", "hnsw", "index tipi: hnsw veya ivfflat")
+	fs.IntVar(&opts.M, "m", 16, "hnsw: node basina baglanti sayisi")
+	fs.IntVar(&opts.EfConstruction, "ef-construction", 64, "hnsw: kurulum sirasindaki aday listesi boyutu")
+	fs.IntVar(&opts.Lists, "lists", 0, "ivfflat: liste sayisi (0 = satir sayisi / 1000)")
+	fs.StringVar(&opts.MaintenanceWorkMem, "maintenance-work-mem", "", "index kurulumu icin maintenance_work_mem (or. 1GB)")
+	return &opts
+}
+
+// runIndex manages the vector index on movies.embedding:
+//
+//	create    builds the index unless one exists
+//	rebuild   builds a new index with other parameters and swaps it in
+//	drop      drops the embedding indexes
+//	status    lists the indexes of movies with their size
+func runIndex(ctx context.Context, args []string) error {
+	fs := newFlagSet("index", "create | rebuild | drop | status")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	action := fs.Arg(0)
+	var opts *indexOptions
+	switch action {
+	case "create", "rebuild":
+		sub := newFlagSet("index "+action, "")
+		opts = indexFlags(sub)
+		if err := parseFlags(sub, fs.Args()[1:]); err != nil {
+			return err
+		}
+		if opts.Type != "hnsw" && opts.Type != "ivfflat" {
+			return fmt.Errorf("%w: -type must be hnsw or ivfflat", errUsage)
+		}
+	case "drop", "status":
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: unknown index command %q", errUsage, action)
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	// CONCURRENTLY ve SET komutlari ayni oturumda calismali
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer logging.CloseQuietly(conn)
+
+	switch action {
+	case "create":
+		return createIndex(ctx, conn, *opts)
+	case "rebuild":
+		return rebuildIndex(ctx, conn, *opts)
+	case "drop":
+		return dropIndexes(ctx, conn)
+	}
+	return printIndexStatus(ctx, conn)
+}
+
+// indexName is the name of the index "moviedb index" builds. It differs
+// from movies_embedding_hnsw_idx of migration 0002 so the command never
+// touches the migration's index by name; the 0002 down migration drops both.
+func indexName(indexType string) string {
+	return fmt.Sprintf("movies_embedding_%s_managed_idx", indexType)
+}
+
+func indexDefinition(ctx context.Context, conn *sql.Conn, name string, opts indexOptions) (string, error) {
+	switch opts.Type {
+	case "hnsw":
+		return fmt.Sprintf(`CREATE INDEX CONCURRENTLY %s ON movies USING hnsw (embedding vector_cosine_ops) WITH (m = %d, ef_construction = %d)`,
+			name, opts.M, opts.EfConstruction), nil
+	case "ivfflat":
+		lists := opts.Lists
+		if lists <= 0 {
+			// pgvector onerisi: 1M satira kadar satir sayisi / 1000
+			var rows int
+			if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM movies WHERE embedding IS NOT NULL`).Scan(&rows); err != nil {
+				return "", err
+			}
+			lists = max(rows/1000, 10)
+		}
+		return fmt.Sprintf(`CREATE INDEX CONCURRENTLY %s ON movies USING ivfflat (embedding vector_cosine_ops) WITH (lists = %d)`,
+			name, lists), nil
+	}
+	return "", fmt.Errorf("unknown index type %q", opts.Type)
+}
+
+func setMaintenanceMem(ctx context.Context, conn *sql.Conn, opts indexOptions) error {
+	if opts.MaintenanceWorkMem == "" {
+		return nil
+	}
+	_, err := conn.ExecContext(ctx, `SELECT set_config('maintenance_work_mem', $1, false)`, opts.MaintenanceWorkMem)
+	return err
+}
+
+func build(ctx context.Context, conn *sql.Conn, name string, opts indexOptions) error {
+	if err := setMaintenanceMem(ctx, conn, opts); err != nil {
+		return err
+	}
+	stmt, err := indexDefinition(ctx, conn, name, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Index kuruluyor: %s\n", stmt)
+	start := time.Now()
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		// Yarim kalan CONCURRENTLY index'i gecersiz olarak kalir, temizle
+		_, _ = conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+name)
+		return err
+	}
+	fmt.Printf("Index hazir: %s (%s)\n", name, time.Since(start).Round(time.Second))
+	return nil
+}
+
+func createIndex(ctx context.Context, conn *sql.Conn, opts indexOptions) error {
+	existing, err := embeddingIndexes(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		fmt.Printf("Embedding index'i zaten var (%s), parametreleri degistirmek icin rebuild kullanin.\n", strings.Join(existing, ", "))
+		return nil
+	}
+	return build(ctx, conn, indexName(opts.Type), opts)
+}
+
+// rebuildIndex builds the new index next to the old one and swaps names, so
+// searches keep using an index for the whole rebuild.
+func rebuildIndex(ctx context.Context, conn *sql.Conn, opts indexOptions) error {
+	name := indexName(opts.Type)
+	tmpName := name + "_new"
+
+	if _, err := conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+tmpName); err != nil {
+		return err
+	}
+	if err := build(ctx, conn, tmpName, opts); err != nil {
+		return err
+	}
+
+	old, err := embeddingIndexes(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, idx := range old {
+		if idx == tmpName {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+idx); err != nil {
+			return err
+		}
+		fmt.Printf("Eski index silindi: %s\n", idx)
+	}
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER INDEX %s RENAME TO %s", tmpName, name))
+	return err
+}
+
+func dropIndexes(ctx context.Context, conn *sql.Conn) error {
+	names, err := embeddingIndexes(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, idx := range names {
+		if _, err := conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+idx); err != nil {
+			return err
+		}
+		fmt.Printf("Index silindi: %s\n", idx)
+	}
+	return nil
+}
+
+// embeddingIndexes lists every hnsw/ivfflat index on movies.embedding.
+func embeddingIndexes(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT indexname FROM pg_indexes
+		WHERE tablename = 'movies' AND (indexdef ILIKE '%USING hnsw%' OR indexdef ILIKE '%USING ivfflat%')`)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+
+	var names []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+func printIndexStatus(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT i.indexname, pg_size_pretty(pg_relation_size(c.oid)), x.indisvalid, i.indexdef
+		FROM pg_indexes i
+		JOIN pg_class c ON c.relname = i.indexname
+		JOIN pg_index x ON x.indexrelid = c.oid
+		WHERE i.tablename = 'movies'
+		ORDER BY i.indexname`)
+	if err != nil {
+		return err
+	}
+	defer logging.CloseQuietly(rows)
+
+	for rows.Next() {
+		var name, size, def string
+		var valid bool
+		if err := rows.Scan(&name, &size, &valid, &def); err != nil {
+			return err
+		}
+		state := "gecerli"
+		if !valid {
+			state = "GECERSIZ"
+		}
+		def = def[strings.Index(def, " USING ")+1:]
+		fmt.Printf("%-36s %10s  %-8s %s\n", name, size, state, def)
+	}
+	return rows.Err()
+}
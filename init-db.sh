@@ -3,9 +3,13 @@ set -e
 
 LOCK_FILE="/root/setup_done.lock"
 
+go build -o /tmp/moviedb .
+
+/tmp/moviedb migrate up
+
 if [ ! -f "$LOCK_FILE" ]; then
-  go run ./seed/seeder.go
-  go run ./data-updater/updater.go
-  go run ./embed/embedder.go
+  /tmp/moviedb seed
+  /tmp/moviedb sync
+  /tmp/moviedb embed
   touch "$LOCK_FILE"
-fi
\ No newline at end of file
+fi
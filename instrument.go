@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/metrics"
+)
+
+// httpMetrics records the count and latency of every request. Requests are
+// labelled with the registered route (/api/movies/:id), not the raw path,
+// so ids do not create new series.
+func httpMetrics(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := responseStatus(c, err)
+	route := c.Route().Path
+	if status == fiber.StatusNotFound && route == "/" {
+		route = "unmatched"
+	}
+
+	labels := []string{route, c.Method(), strconv.Itoa(status)}
+	metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+	metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// responseStatus is the status the client gets, including errors returned
+// by handlers that the Fiber error handler has not turned into a response
+// yet.
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
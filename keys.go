@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"movie-search-db/apikeys"
+)
+
+// keyOptions are the flags of "keys create".
+type keyOptions struct {
+	Name  string
+	Rate  int
+	Daily int
+	Admin bool
+}
+
+// runKeys manages the API keys of other services:
+//
+//	create    creates a key and prints it once
+//	revoke    revokes a key by id or prefix
+//	list      lists every key with its limits and state
+func runKeys(ctx context.Context, args []string) error {
+	fs := newFlagSet("keys", "create | revoke <id|prefix> | list")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	action := fs.Arg(0)
+	var opts keyOptions
+	switch action {
+	case "create":
+		sub := newFlagSet("keys create", "")
+		sub.StringVar(&opts.Name, "name", "", "anahtarin sahibi / kullanim amaci")
+		sub.IntVar(&opts.Rate, "rate", 60, "dakika basina istek limiti (0 = limitsiz)")
+		sub.IntVar(&opts.Daily, "daily", 10000, "gunluk istek kotasi (0 = limitsiz)")
+		sub.BoolVar(&opts.Admin, "admin", false, "yonetim endpoint'lerine (/api/admin) erisim")
+		if err := parseFlags(sub, fs.Args()[1:]); err != nil {
+			return err
+		}
+		if opts.Name == "" {
+			return fmt.Errorf("%w: -name is required", errUsage)
+		}
+		if opts.Rate < 0 || opts.Daily < 0 {
+			return fmt.Errorf("%w: -rate and -daily must not be negative", errUsage)
+		}
+	case "revoke":
+		if fs.NArg() < 2 {
+			return fmt.Errorf("%w: revoke needs the id or prefix of the key", errUsage)
+		}
+	case "list":
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: unknown keys command %q", errUsage, action)
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	store := apikeys.NewStore(db)
+
+	switch action {
+	case "create":
+		key, plain, err := store.Create(ctx, opts.Name, opts.Rate, opts.Daily, opts.Admin)
+		if err != nil {
+			return fmt.Errorf("create key: %w", err)
+		}
+		fmt.Printf("Anahtar olusturuldu (id %d, %s).\n", key.ID, key.Name)
+		fmt.Println("Bu degeri simdi kaydedin, tekrar gosterilmeyecek:")
+		fmt.Println(plain)
+		return nil
+
+	case "revoke":
+		err := store.Revoke(ctx, fs.Arg(1))
+		if errors.Is(err, apikeys.ErrNotFound) {
+			return fmt.Errorf("no active key %s", fs.Arg(1))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Anahtar iptal edildi: %s\n", fs.Arg(1))
+		return nil
+	}
+	return printKeys(ctx, store)
+}
+
+func printKeys(ctx context.Context, store *apikeys.Store) error {
+	keys, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-4s %-20s %-14s %8s %8s  %-16s %s\n", "ID", "ISIM", "PREFIX", "DAKIKA", "GUNLUK", "SON KULLANIM", "DURUM")
+	for _, k := range keys {
+		lastUsed := "-"
+		if k.LastUsedAt.Valid {
+			lastUsed = k.LastUsedAt.Time.Format("2006-01-02 15:04")
+		}
+		state := "aktif"
+		if k.Admin {
+			state = "aktif (admin)"
+		}
+		if k.Revoked() {
+			state = "iptal " + k.RevokedAt.Time.Format("2006-01-02")
+		}
+		fmt.Printf("%-4d %-20s %-14s %8d %8d  %-16s %s\n", k.ID, k.Name, k.Prefix, k.RateLimitPerMinute, k.DailyQuota, lastUsed, state)
+	}
+	return nil
+}
@@ -1,133 +1,78 @@
-package main
+// Package translator fills the Turkish title, tagline and overview of
+// movies that do not have them yet from the TMDB API.
+package translator
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"sync"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"movie-search-db/catalog"
+	"movie-search-db/metrics"
+	"movie-search-db/pool"
+	"movie-search-db/tmdb"
 )
 
-const (
-	WorkerCount = 20
-	TMDBURL     = "https://api.themoviedb.org/3/movie/%d?api_key=%s&language=tr-TR"
-)
-
-type TMDBFullResponse struct {
-	Title      string  `json:"title"`
-	Overview   string  `json:"overview"`
-	Tagline    string  `json:"tagline"`
-	PosterPath *string `json:"poster_path"`
-}
+const DefaultWorkers = 20
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal(".env yuklenemedi")
-	}
+type Options struct {
+	Workers int
+	// TMDB is shared by all workers, it keeps them under the rate limit.
+	TMDB *tmdb.Client
 }
 
-func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
-
-	db, err := sql.Open("postgres", dsn)
+func Run(ctx context.Context, db *sql.DB, opts Options) error {
+	start := time.Now()
+	movies, err := catalog.Refs(ctx, db, "overview_tr IS NULL")
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
-
-	rows, err := db.Query("SELECT id, tmdb_id FROM movies WHERE tmdb_id IS NOT NULL AND overview_tr IS NULL ORDER BY popularity DESC")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(rows)
-
-	jobs := make(chan [2]int, 100)
-	var wg sync.WaitGroup
-
-	for i := 0; i < WorkerCount; i++ {
-		wg.Add(1)
-		go worker(db, jobs, &wg)
+		return fmt.Errorf("listing movies: %w", err)
 	}
 
-	for rows.Next() {
-		var id, tmdbID int
-		if err := rows.Scan(&id, &tmdbID); err != nil {
-			continue
-		}
-		jobs <- [2]int{id, tmdbID}
-	}
-
-	close(jobs)
-	wg.Wait()
-	fmt.Println("Turkce veri senkronizasyonu tamamlandi.")
-}
-
-func worker(db *sql.DB, jobs <-chan [2]int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	client := &http.Client{Timeout: 10 * time.Second}
-	apiKey := os.Getenv("TMDB_API_KEY")
-
-	for job := range jobs {
-		dbID, tmdbID := job[0], job[1]
-		data, err := fetchTRData(client, tmdbID, apiKey)
-		if err != nil {
-			continue
+	job := metrics.StartJob("translate")
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	err = pool.Run(ctx, opts.Workers, movies, func(ctx context.Context, m catalog.Ref) {
+		data, err := opts.TMDB.Movie(ctx, m.TmdbID, "tr-TR")
+		switch {
+		case errors.Is(err, tmdb.ErrUnauthorized):
+			slog.Error("tmdb rejected the api key, stopping", "stage", "fetch", "tmdb_id", m.TmdbID, "err", err)
+			abort(err)
+			job.Failed(1)
+			return
+		case errors.Is(err, tmdb.ErrNotFound):
+			slog.Warn("movie not found on tmdb", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID)
+			job.Skipped(1)
+			return
+		case err != nil:
+			slog.Error("translation failed", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+			job.Failed(1)
+			return
 		}
 
 		query := `
 			UPDATE movies 
-			SET title_tr = $1, overview_tr = $2, tagline_tr = $3, poster_path = COALESCE($4, poster_path)
+			SET title_tr = $1, overview_tr = $2, tagline_tr = $3, poster_path = COALESCE($4, poster_path),
+			    search_vector = movie_search_vector(title, $1, overview, $2, keywords, cast_list)
 			WHERE id = $5`
 
-		_, err = db.Exec(query, data.Title, data.Overview, data.Tagline, data.PosterPath, dbID)
+		_, err = db.ExecContext(ctx, query, data.Title, data.Overview, data.Tagline, data.PosterPath, m.ID)
 		if err != nil {
-			log.Printf("ID %d Update Hatasi: %v", dbID, err)
+			slog.Error("translation failed", "stage", "update", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+			job.Failed(1)
 		} else {
-			fmt.Printf("Film %d (%s) Turkcelestirildi.\n", dbID, data.Title)
+			slog.Info("movie translated", "movie_id", m.ID, "tmdb_id", m.TmdbID, "title", data.Title)
+			job.OK(1)
 		}
-		time.Sleep(50 * time.Millisecond)
-	}
-}
-
-func fetchTRData(client *http.Client, tmdbID int, apiKey string) (*TMDBFullResponse, error) {
-	url := fmt.Sprintf(TMDBURL, tmdbID, apiKey)
-	resp, err := client.Get(url)
+	})
+	catalog.BumpIfChanged(ctx, db, "translate", job.Succeeded())
 	if err != nil {
-		return nil, err
+		return context.Cause(ctx)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	var res TMDBFullResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-	return &res, nil
+	job.Finish()
+	slog.Info("translation sync finished", "movies", len(movies), "duration", time.Since(start))
+	return job.Err()
 }
@@ -0,0 +1,76 @@
+// Package logging configures log/slog for the API server and the batch
+// tools so every binary writes the same structured records.
+//
+// Field names shared by all binaries:
+//
+//	request_id  API request id (X-Request-ID)
+//	movie_id    movies.id
+//	tmdb_id     movies.tmdb_id
+//	stage       step of a job that failed or finished (fetch, update, embed, ...)
+//	duration    time spent, as a Go duration
+//	err         the error
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup installs the default logger for service and returns it. format
+// selects text (default) or json output and level one of debug, info, warn
+// or error. Output of the standard log package goes through the same
+// handler.
+func Setup(service, format, level string) *slog.Logger {
+	l := New(os.Stderr, format, level).With("service", service)
+	slog.SetDefault(l)
+	return l
+}
+
+func New(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+func parseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+type ctxKey struct{}
+
+// WithLogger attaches l to ctx.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger attached to ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// Fatal logs msg at error level and exits with status 1.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// CloseQuietly closes c and logs a failure. It is meant for deferred
+// closes whose error cannot change the outcome, e.g. response bodies and
+// rows that were read to the end.
+func CloseQuietly(c io.Closer) {
+	if err := c.Close(); err != nil {
+		slog.Warn("close failed", "err", err)
+	}
+}
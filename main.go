@@ -1,26 +1,36 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+
+	"movie-search-db/apikeys"
+	"movie-search-db/captcha"
+	"movie-search-db/config"
+	"movie-search-db/embedding"
+	"movie-search-db/logging"
+	"movie-search-db/metrics"
 )
 
 type SearchRequest struct {
-	Query        string `json:"query"`
-	CaptchaToken string `json:"captchaToken"`
+	Query        string        `json:"query"`
+	Mode         string        `json:"mode"`
+	CaptchaToken string        `json:"captchaToken"`
+	Filters      SearchFilters `json:"filters"`
+	Limit        int           `json:"limit"`
+	Cursor       string        `json:"cursor"`
+	Profile      string        `json:"profile"`
+	Explain      bool          `json:"explain"`
 }
 
 type MovieResponse struct {
@@ -33,202 +43,194 @@ type MovieResponse struct {
 	Vote   float64 `json:"Vote"`
 	Sim    float64 `json:"Sim"`
 	Score  float64 `json:"Score"`
-}
 
-type RecaptchaResponse struct {
-	Success bool    `json:"success"`
-	Score   float64 `json:"score"`
+	Breakdown *ScoreBreakdown `json:"Breakdown,omitempty"`
 }
 
-var db *sql.DB
+var (
+	cfg             *config.Config
+	db              *sql.DB
+	embedder        embedding.Embedder
+	ann             annConfig
+	rankingProfiles map[string]RankingProfile
+	verifier        captcha.Verifier
+	apiKeyStore     *apikeys.Store
+)
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Println(".env bulunamadı")
-	}
+const usage = `Kullanim: moviedb [-config dosya] <komut> [bayraklar]
+
+Komutlar:
+  serve      HTTP API'yi baslatir
+  seed       datas/ altindaki CSV dosyalarini veritabanina aktarir
+  sync       Filmleri TMDB API'den gunceller (-incremental: sadece degisenler)
+  embed      Embedding'i olmayan filmlerin vektorlerini olusturur
+  posters    Poster yollarini TMDB API'den yeniler
+  translate  Turkce baslik ve ozeti eksik filmleri TMDB API'den doldurur
+  migrate    Schema migration'larini yonetir (up, down [n], status, version)
+  index      Embedding vektor index'ini yonetir (create, rebuild, drop, status)
+  keys       Servisler arasi API anahtarlarini yonetir (create, revoke, list)
+  stats      Arama istatistiklerini raporlar ve search_log'u temizler (report, prune)
+  config     Gecerli yapilandirmayi gizli degerleri maskeleyerek yazar
+  fake-tmdb  Yerel testler icin sahte bir TMDB API'si calistirir (TMDB_BASE_URL)
+
+Ayarlar sirasiyla varsayilanlardan, -config dosyasindan, .env'den ve ortam
+degiskenlerinden okunur; komut bayraklari hepsini ezer.
+Komut bayraklari icin: moviedb <komut> -h
+
+Genel bayraklar:`
+
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"serve":     runServe,
+	"seed":      runSeed,
+	"sync":      runSync,
+	"embed":     runEmbed,
+	"posters":   runPosters,
+	"translate": runTranslate,
+	"migrate":   runMigrate,
+	"index":     runIndex,
+	"keys":      runKeys,
+	"stats":     runStats,
+	"config":    runConfig,
+	"fake-tmdb": runFakeTMDB,
 }
 
 func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
+	global := flag.NewFlagSet("moviedb", flag.ContinueOnError)
+	configFile := global.String("config", os.Getenv("CONFIG_FILE"), "YAML veya TOML yapilandirma dosyasi (CONFIG_FILE)")
+	global.Usage = func() {
+		_, _ = fmt.Fprintln(global.Output(), usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+	if global.NArg() < 1 {
+		global.Usage()
+		os.Exit(2)
+	}
+	name := global.Arg(0)
+	if name == "help" {
+		global.SetOutput(os.Stdout)
+		global.Usage()
+		return
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Bilinmeyen komut: %s\n\n", name)
+		global.Usage()
+		os.Exit(2)
+	}
 
 	var err error
-	db, err = sql.Open("postgres", dsn)
+	cfg, err = config.Load(*configFile)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	service := name
+	if name == "serve" {
+		service = "api"
+	}
+	logging.Setup(service, cfg.Log.Format, cfg.Log.Level)
+	metrics.JobExport.Addr = cfg.Metrics.Addr
+	metrics.JobExport.PushgatewayURL = cfg.Metrics.PushgatewayURL
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = run(ctx, global.Args()[1:])
+	stop()
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	default:
+		slog.Error("command failed", "command", name, "err", err)
+		os.Exit(1)
 	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
-
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Minute * 5)
-
-	app := fiber.New(fiber.Config{
-		DisableStartupMessage: false,
-		ReadTimeout:           10 * time.Second,
-	})
-
-	app.Use(cors.New())
-
-	app.Post("/api/search", handleSearch)
-
-	log.Fatal(app.Listen(":8080"))
 }
 
 func handleSearch(c *fiber.Ctx) error {
+	start := time.Now()
 	var req SearchRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid_request"})
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_request"})
 	}
 
-	if req.CaptchaToken == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "captcha_required"})
+	trusted := requestAPIKey(c) != nil
+	if req.CaptchaToken == "" && !trusted {
+		return errorJSON(c, 400, fiber.Map{"error": "captcha_required"})
 	}
 
 	if req.Query == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "query_required"})
+		return errorJSON(c, 400, fiber.Map{"error": "query_required"})
 	}
 
-	valid, err := verifyRecaptcha(req.CaptchaToken)
-	if err != nil || !valid {
-		return c.Status(403).JSON(fiber.Map{"error": "bot_detected"})
+	opts, errBody := parseSearchOptions(&req.Filters, req.Limit, req.Cursor, req.Profile)
+	if errBody != nil {
+		return errorJSON(c, 400, errBody)
 	}
 
-	embedding, err := getEmbedding(req.Query)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "embedding_failed"})
-	}
-
-	vectorJSON, _ := json.Marshal(embedding)
-
-	const query = `WITH MatchData AS (
-    SELECT 
-        id, 
-        tmdb_id, 
-        COALESCE(NULLIF(TRIM(title_tr), ''), title) AS title,
-        COALESCE(NULLIF(TRIM(tagline_tr), ''), tagline) AS tagline,
-        COALESCE(NULLIF(TRIM(overview_tr), ''), overview) AS overview,
-        poster_path, 
-        vote_average,
-        popularity,
-        (1 - (embedding <=> $1)) AS sim
-    FROM movies
-    WHERE embedding IS NOT NULL 
-      AND vote_count > 10
-)
-SELECT 
-    id, 
-    tmdb_id, 
-    title, 
-    tagline, 
-    overview, 
-    poster_path, 
-    vote_average,
-    sim,
-    ((sim * 0.85) + ((vote_average / 10.0) * 0.10) + (LOG(GREATEST(popularity, 1.0)) / 10.0 * 0.05)) AS score
-FROM MatchData
-WHERE sim > 0.35
-ORDER BY score DESC
-LIMIT 12;`
-
-	rows, err := db.Query(query, string(vectorJSON))
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "database_error"})
+	switch req.Mode {
+	case "":
+		req.Mode = SearchModeVector
+	case SearchModeVector, SearchModeHybrid:
+	default:
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_mode", "field": "mode"})
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
+
+	if !trusted {
+		valid, err := verifier.Verify(c.UserContext(), req.CaptchaToken, clientIP(c))
 		if err != nil {
-			fmt.Println(err)
+			requestLogger(c).Warn("captcha verification failed", "stage", "captcha", "err", err)
+			if ctxErr := c.UserContext().Err(); ctxErr != nil {
+				return serverError(c, ctxErr, "captcha_failed")
+			}
 		}
-	}(rows)
-
-	results := make([]MovieResponse, 0)
-	for rows.Next() {
-		var m MovieResponse
-		var t, tg, ov, p sql.NullString
-		if err := rows.Scan(&m.ID, &m.TmdbID, &t, &tg, &ov, &p, &m.Vote, &m.Sim, &m.Score); err != nil {
-			continue
+		if err != nil || !valid {
+			return errorJSON(c, 403, fiber.Map{"error": "bot_detected"})
 		}
-		m.Title = t.String
-		m.Tag = tg.String
-		m.Ov = ov.String
-		m.Post = p.String
-		results = append(results, m)
-	}
-
-	if len(results) == 0 {
-		return c.Status(404).JSON(fiber.Map{"message": "no_results", "results": []MovieResponse{}})
-	}
-
-	return c.JSON(results)
-}
-
-func verifyRecaptcha(token string) (bool, error) {
-	secret := os.Getenv("RECAPTCHA_PRIVATE_KEY")
-	data := url.Values{
-		"secret":   {secret},
-		"response": {token},
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.PostForm("https://www.google.com/recaptcha/api/siteverify", data)
-	if err != nil {
-		return false, err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
+	cacheKey := ""
+	c.Set("X-Cache", CacheBypass)
+	if results != nil {
+		cacheKey = results.key(&req, opts)
+		if cached, ok := results.get(cacheKey); ok {
+			c.Set("X-Cache", CacheHit)
+			logSearch(c, &req, cached, start, true)
+			return respondSearch(c, cached)
 		}
-	}(resp.Body)
-
-	var res RecaptchaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return false, err
+		c.Set("X-Cache", CacheMiss)
 	}
 
-	return res.Success && res.Score >= 0.5, nil
-}
-
-func getEmbedding(text string) ([]float32, error) {
-	ollamaUrl := fmt.Sprintf("%s/api/embed", os.Getenv("OLLAMA_BASE_URL"))
-	reqBody, _ := json.Marshal(map[string]string{
-		"model": "bge-m3",
-		"input": text,
+	vector, err := embedding.One(c.UserContext(), embedder, req.Query)
+	if err != nil {
+		requestLogger(c).Error("search failed", "stage", "embed", "err", err)
+		return serverError(c, err, "embedding_failed")
+	}
+
+	resp, err := runSearch(c.UserContext(), searchParams{
+		Mode:    req.Mode,
+		Query:   req.Query,
+		Vector:  vector,
+		Filters: req.Filters,
+		Limit:   opts.Limit,
+		Cursor:  opts.Cursor,
+		Profile: opts.Profile,
+		Explain: req.Explain,
 	})
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post(ollamaUrl, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ollama_status_%d", resp.StatusCode)
-	}
-
-	var res struct {
-		Embeddings [][]float32 `json:"embeddings"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-
-	if len(res.Embeddings) == 0 {
-		return nil, fmt.Errorf("empty_embedding")
+		requestLogger(c).Error("search failed", "stage", "query", "err", err)
+		return serverError(c, err, "database_error")
 	}
+	results.put(cacheKey, resp)
+	logSearch(c, &req, resp, start, false)
 
-	return res.Embeddings[0], nil
+	return respondSearch(c, resp)
 }
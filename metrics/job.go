@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// JobExport says where job metrics go. The metrics are pushed to the
+// Pushgateway at PushgatewayURL when a job finishes and, when Addr is set
+// (e.g. ":9101"), served on /metrics while the job runs.
+var JobExport struct {
+	Addr           string
+	PushgatewayURL string
+}
+
+// Job collects the metrics of one batch tool run, see JobExport.
+type Job struct {
+	name     string
+	registry *prometheus.Registry
+	start    time.Time
+
+	items       *prometheus.CounterVec
+	duration    prometheus.Gauge
+	lastSuccess prometheus.Gauge
+
+	server *http.Server
+
+	ok, failed atomic.Int64
+}
+
+func StartJob(name string) *Job {
+	j := &Job{name: name, registry: prometheus.NewRegistry(), start: time.Now()}
+	labels := prometheus.Labels{"job_name": name}
+
+	j.items = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Name:        "job_items_total",
+		Help:        "Items processed by the job, by result (ok, failed, skipped).",
+		ConstLabels: labels,
+	}, []string{"result"})
+	j.duration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "job_duration_seconds",
+		Help:        "Duration of the last job run.",
+		ConstLabels: labels,
+	})
+	j.lastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "job_last_success_timestamp_seconds",
+		Help:        "Unix time the job last finished.",
+		ConstLabels: labels,
+	})
+	j.registry.MustRegister(j.items, j.duration, j.lastSuccess)
+
+	if addr := JobExport.Addr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(j.registry, promhttp.HandlerOpts{}))
+		j.server = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			if err := j.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("metrics server failed", "addr", addr, "err", err)
+			}
+		}()
+	}
+	return j
+}
+
+func (j *Job) OK(n int) {
+	j.ok.Add(int64(n))
+	j.items.WithLabelValues("ok").Add(float64(n))
+}
+
+func (j *Job) Failed(n int) {
+	j.failed.Add(int64(n))
+	j.items.WithLabelValues("failed").Add(float64(n))
+}
+
+// Succeeded returns the number of items recorded with OK.
+func (j *Job) Succeeded() int64 { return j.ok.Load() }
+
+func (j *Job) Skipped(n int) { j.items.WithLabelValues("skipped").Add(float64(n)) }
+
+// Err reports a run in which every item failed. That usually means a
+// broken dependency (bad TMDB key, model not pulled) rather than bad data,
+// so the command should exit with an error.
+func (j *Job) Err() error {
+	if ok, failed := j.ok.Load(), j.failed.Load(); ok == 0 && failed > 0 {
+		return fmt.Errorf("%s: all %d items failed", j.name, failed)
+	}
+	return nil
+}
+
+// Finish records the run as successful and pushes the metrics.
+func (j *Job) Finish() {
+	j.duration.Set(time.Since(j.start).Seconds())
+	j.lastSuccess.SetToCurrentTime()
+
+	if url := JobExport.PushgatewayURL; url != "" {
+		err := push.New(url, namespace+"_"+j.name).Gatherer(j.registry).Push()
+		if err != nil {
+			slog.Error("metrics push failed", "job", j.name, "err", err)
+		}
+	}
+	if j.server != nil {
+		_ = j.server.Close()
+	}
+}
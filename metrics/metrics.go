@@ -0,0 +1,165 @@
+// Package metrics defines the Prometheus metrics of the API server and the
+// wrappers that record them around the embedding provider and the captcha
+// verifier. Job metrics of the batch tools live in job.go.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"movie-search-db/captcha"
+	"movie-search-db/embedding"
+)
+
+const namespace = "moviesearch"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "method", "status"})
+
+	EmbeddingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "embedding_request_duration_seconds",
+		Help:      "Latency of embedding provider calls.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"model", "outcome"})
+
+	EmbeddingErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "embedding_errors_total",
+		Help:      "Failed embedding provider calls.",
+	}, []string{"model"})
+
+	CaptchaVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "captcha_verifications_total",
+		Help:      "Captcha verifications by outcome (valid, invalid, error).",
+	}, []string{"provider", "outcome"})
+
+	CaptchaDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "captcha_verification_duration_seconds",
+		Help:      "Latency of captcha verification calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries by query name.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	SearchResults = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_results",
+		Help:      "Number of movies matching a search.",
+		Buckets:   []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	}, []string{"mode"})
+)
+
+// RegisterDB exports the connection pool stats (open, in use, idle, wait
+// count and duration) of db.
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveQuery records the latency of a database query started at start.
+// Use it with defer:
+//
+//	defer metrics.ObserveQuery("search", time.Now())
+func ObserveQuery(name string, start time.Time) {
+	DBQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
+// RegisterEmbeddingCache exports the hit, miss and eviction counters and
+// the size of the query embedding cache c.
+func RegisterEmbeddingCache(c *embedding.Cached) {
+	counter := func(name, help string, labels prometheus.Labels, value func(embedding.CacheStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Name: name, Help: help, ConstLabels: labels,
+		}, func() float64 { return float64(value(c.Stats())) })
+	}
+	prometheus.MustRegister(
+		counter("embedding_cache_hits_total", "Query embeddings served from the cache by tier.",
+			prometheus.Labels{"tier": "memory"}, func(s embedding.CacheStats) int64 { return s.Hits }),
+		counter("embedding_cache_hits_total", "Query embeddings served from the cache by tier.",
+			prometheus.Labels{"tier": "postgres"}, func(s embedding.CacheStats) int64 { return s.PersistentHits }),
+		counter("embedding_cache_misses_total", "Query embeddings computed by the provider.",
+			nil, func(s embedding.CacheStats) int64 { return s.Misses }),
+		counter("embedding_cache_evictions_total", "Entries evicted from the in-memory query embedding cache.",
+			nil, func(s embedding.CacheStats) int64 { return s.Evictions }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "embedding_cache_entries",
+			Help:      "Entries in the in-memory query embedding cache.",
+		}, func() float64 { return float64(c.Stats().Entries) }),
+	)
+}
+
+func outcome(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "ok"
+}
+
+type instrumentedEmbedder struct {
+	embedding.Embedder
+}
+
+// Embedder records latency and errors of every call to e.
+func Embedder(e embedding.Embedder) embedding.Embedder {
+	return instrumentedEmbedder{e}
+}
+
+func (e instrumentedEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	start := time.Now()
+	vecs, err := e.Embedder.Embed(ctx, inputs)
+	EmbeddingDuration.WithLabelValues(e.Model(), outcome(err != nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		EmbeddingErrors.WithLabelValues(e.Model()).Inc()
+	}
+	return vecs, err
+}
+
+type instrumentedVerifier struct {
+	inner    captcha.Verifier
+	provider string
+}
+
+// Verifier records the outcome and latency of every verification made by v.
+func Verifier(v captcha.Verifier, provider string) captcha.Verifier {
+	return instrumentedVerifier{inner: v, provider: provider}
+}
+
+func (v instrumentedVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	start := time.Now()
+	ok, err := v.inner.Verify(ctx, token, remoteIP)
+	CaptchaDuration.WithLabelValues(v.provider).Observe(time.Since(start).Seconds())
+
+	result := "invalid"
+	switch {
+	case err != nil:
+		result = "error"
+	case ok:
+		result = "valid"
+	}
+	CaptchaVerifications.WithLabelValues(v.provider, result).Inc()
+	return ok, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"movie-search-db/migrations"
+)
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := newFlagSet("migrate", "up | down [n] | status | version")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	db, err := openDB(ctx, *dsn, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := migrations.Up(ctx, db)
+		for _, v := range applied {
+			fmt.Printf("Uygulandi: %04d\n", v)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema guncel (versiyon %d).\n", migrations.Latest())
+
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("%w: invalid step count %q", errUsage, fs.Arg(1))
+			}
+		}
+		reverted, err := migrations.Down(ctx, db, steps)
+		for _, v := range reverted {
+			fmt.Printf("Geri alindi: %04d\n", v)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		list, err := migrations.StatusList(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, s := range list {
+			state := "bekliyor"
+			if s.Applied {
+				state = "uygulandi " + s.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-24s %s\n", s.Version, s.Name, state)
+		}
+
+	case "version":
+		v, err := migrations.Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Veritabani: %d, beklenen: %d\n", v, migrations.Latest())
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: unknown migrate command %q", errUsage, fs.Arg(0))
+	}
+	return nil
+}
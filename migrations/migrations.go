@@ -0,0 +1,280 @@
+// Package migrations owns the database schema. Every schema change is a
+// numbered pair of SQL files in sql/ (NNNN_name.up.sql / NNNN_name.down.sql)
+// and the versions applied to a database are recorded in schema_migrations.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"movie-search-db/logging"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID is the advisory lock key that serializes concurrent migrators.
+const lockID = 727_100_001
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt sql.NullTime
+}
+
+var ErrSchemaMismatch = errors.New("schema version mismatch")
+
+// All returns the embedded migrations ordered by version.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		body, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Latest is the schema version this binary was built for.
+func Latest() int {
+	list, err := All()
+	if err != nil || len(list) == 0 {
+		return 0
+	}
+	return list[len(list)-1].Version
+}
+
+func ensureTable(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}) error {
+	_, err := q.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+// Version returns the highest applied migration, 0 for an empty database.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var v int
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// Check refuses to continue unless the database is exactly at the version
+// this binary expects. Binaries call it on startup.
+func Check(ctx context.Context, db *sql.DB) error {
+	current, err := Version(ctx, db)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	latest := Latest()
+	switch {
+	case current < latest:
+		return fmt.Errorf("%w: database is at version %d, expected %d (run the migrate command)", ErrSchemaMismatch, current, latest)
+	case current > latest:
+		return fmt.Errorf("%w: database is at version %d, this binary only knows up to %d", ErrSchemaMismatch, current, latest)
+	}
+	return nil
+}
+
+// StatusList reports every known migration and whether it has been applied.
+func StatusList(ctx context.Context, db *sql.DB) ([]Status, error) {
+	list, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]sql.NullTime)
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.CloseQuietly(rows)
+	for rows.Next() {
+		var v int
+		var at sql.NullTime
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(list))
+	for _, m := range list {
+		at, ok := applied[m.Version]
+		out = append(out, Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return out, nil
+}
+
+// Up applies every pending migration, each in its own transaction. It
+// returns the versions that were applied.
+func Up(ctx context.Context, db *sql.DB) ([]int, error) {
+	list, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		if err := ensureTable(ctx, conn); err != nil {
+			return err
+		}
+		current, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			if m.Version <= current {
+				continue
+			}
+			if err := apply(ctx, conn, m.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations.
+func Down(ctx context.Context, db *sql.DB, steps int) ([]int, error) {
+	list, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		if err := ensureTable(ctx, conn); err != nil {
+			return err
+		}
+		current, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+			m := list[i]
+			if m.Version > current {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+			}
+			if err := apply(ctx, conn, m.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func apply(ctx context.Context, conn *sql.Conn, script string, record func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func withLock(ctx context.Context, db *sql.DB, fn func(*sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer logging.CloseQuietly(conn)
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+	return fn(conn)
+}
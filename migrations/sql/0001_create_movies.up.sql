@@ -0,0 +1,29 @@
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS movies (
+    id SERIAL PRIMARY KEY,
+    tmdb_id INTEGER UNIQUE,
+    title TEXT,
+    title_tr TEXT,
+    tagline TEXT,
+    tagline_tr TEXT,
+    overview TEXT,
+    overview_tr TEXT,
+    genres JSONB,
+    keywords JSONB,
+    cast_list JSONB,
+    director TEXT,
+    release_date DATE,
+    popularity DOUBLE PRECISION,
+    vote_average DOUBLE PRECISION,
+    vote_count INTEGER,
+    original_language TEXT,
+    poster_path TEXT,
+    embedding vector(1024)
+);
+
+-- Databases created by older seeders may be missing the TMDB metadata columns.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS genres JSONB;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS keywords JSONB;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS cast_list JSONB;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS director TEXT;
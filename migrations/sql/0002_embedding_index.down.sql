@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movies_vote_count_idx;
+DROP INDEX IF EXISTS movies_embedding_hnsw_idx;
+-- indexes built by "moviedb index"
+DROP INDEX IF EXISTS movies_embedding_hnsw_managed_idx;
+DROP INDEX IF EXISTS movies_embedding_ivfflat_managed_idx;
+DROP INDEX IF EXISTS movies_embedding_hnsw_managed_idx_new;
+DROP INDEX IF EXISTS movies_embedding_ivfflat_managed_idx_new;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS movies_embedding_hnsw_idx
+    ON movies USING hnsw (embedding vector_cosine_ops);
+
+CREATE INDEX IF NOT EXISTS movies_vote_count_idx ON movies (vote_count);
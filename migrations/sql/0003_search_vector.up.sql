@@ -0,0 +1,22 @@
+-- Full-text document for hybrid search. Titles and cast names are indexed
+-- with the 'simple' config as well, so exact names match without stemming.
+CREATE OR REPLACE FUNCTION movie_search_vector(
+    title TEXT, title_tr TEXT, overview TEXT, overview_tr TEXT, keywords JSONB, cast_list JSONB
+) RETURNS tsvector
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+    SELECT
+        setweight(to_tsvector('simple', COALESCE(title, '') || ' ' || COALESCE(title_tr, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('turkish', COALESCE(title_tr, '')), 'A') ||
+        setweight(jsonb_to_tsvector('simple', COALESCE(cast_list, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(jsonb_to_tsvector('english', COALESCE(keywords, '[]'::jsonb), '["string"]'), 'C') ||
+        setweight(to_tsvector('english', COALESCE(overview, '')), 'D') ||
+        setweight(to_tsvector('turkish', COALESCE(overview_tr, '')), 'D')
+$$;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+UPDATE movies
+SET search_vector = movie_search_vector(title, title_tr, overview, overview_tr, keywords, cast_list);
+
+CREATE INDEX IF NOT EXISTS movies_search_vector_idx ON movies USING gin (search_vector);
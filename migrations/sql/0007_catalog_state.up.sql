@@ -0,0 +1,10 @@
+-- Bumped by the batch jobs whenever they change movie data, so the API
+-- can drop cached search results.
+CREATE TABLE IF NOT EXISTS catalog_state (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version BIGINT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_by TEXT
+);
+
+INSERT INTO catalog_state (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
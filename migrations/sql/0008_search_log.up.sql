@@ -0,0 +1,19 @@
+-- Append-only log of searches, pruned by the retention job.
+CREATE TABLE IF NOT EXISTS search_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    query TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    profile TEXT NOT NULL,
+    filters JSONB,
+    result_ids INTEGER[] NOT NULL,
+    total INTEGER NOT NULL,
+    top_score DOUBLE PRECISION,
+    latency_ms DOUBLE PRECISION NOT NULL,
+    cache_hit BOOLEAN NOT NULL,
+    zero_results BOOLEAN NOT NULL,
+    client_hash TEXT NOT NULL,
+    api_key_id INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS search_log_created_at_idx ON search_log (created_at);
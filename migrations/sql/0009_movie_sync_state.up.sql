@@ -0,0 +1,13 @@
+-- Per-movie progress of `moviedb sync`. A run skips movies synced within
+-- the freshness window, so an interrupted run resumes where it stopped.
+CREATE TABLE IF NOT EXISTS movie_sync_state (
+    movie_id INTEGER PRIMARY KEY REFERENCES movies (id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('ok', 'failed')),
+    last_synced_at TIMESTAMPTZ,
+    last_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- failed attempts since the last successful sync
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS movie_sync_state_failed_idx ON movie_sync_state (movie_id) WHERE status = 'failed';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sync_checkpoints;
+DROP INDEX IF EXISTS movies_needs_embedding_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS needs_embedding;
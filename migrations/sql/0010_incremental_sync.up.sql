@@ -0,0 +1,12 @@
+-- Set when synced data that goes into the embedding document changed;
+-- `moviedb embed` re-embeds these rows and clears the flag.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS needs_embedding BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS movies_needs_embedding_idx ON movies (id) WHERE needs_embedding;
+
+-- Start time of the last successful run per sync feed, e.g. the TMDB
+-- changes feed of `moviedb sync -incremental`.
+CREATE TABLE IF NOT EXISTS sync_checkpoints (
+    name TEXT PRIMARY KEY,
+    synced_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Admin keys may call /api/admin/*.
+ALTER TABLE api_keys ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,7 @@
+-- Salt of search_log.client_hash when SEARCH_LOG_SALT is not set. The API
+-- generates it on first start and every instance reads the same value.
+CREATE TABLE IF NOT EXISTS search_log_salt (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    salt TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
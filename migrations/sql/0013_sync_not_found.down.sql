@@ -0,0 +1,4 @@
+UPDATE movie_sync_state SET status = 'failed' WHERE status = 'not_found';
+ALTER TABLE movie_sync_state DROP CONSTRAINT IF EXISTS movie_sync_state_status_check;
+ALTER TABLE movie_sync_state ADD CONSTRAINT movie_sync_state_status_check
+    CHECK (status IN ('ok', 'failed'));
@@ -0,0 +1,4 @@
+-- not_found marks movies deleted from TMDB; sync runs no longer pick them up.
+ALTER TABLE movie_sync_state DROP CONSTRAINT IF EXISTS movie_sync_state_status_check;
+ALTER TABLE movie_sync_state ADD CONSTRAINT movie_sync_state_status_check
+    CHECK (status IN ('ok', 'failed', 'not_found'));
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/metrics"
+)
+
+type CastMember struct {
+	Name      string `json:"Name"`
+	Character string `json:"Character,omitempty"`
+}
+
+type MovieDetail struct {
+	ID           int          `json:"ID"`
+	TmdbID       int          `json:"TmdbID"`
+	Title        string       `json:"Title"`
+	TitleTR      string       `json:"TitleTR"`
+	Tagline      string       `json:"Tagline"`
+	TaglineTR    string       `json:"TaglineTR"`
+	Overview     string       `json:"Overview"`
+	OverviewTR   string       `json:"OverviewTR"`
+	Genres       []string     `json:"Genres"`
+	Keywords     []string     `json:"Keywords"`
+	Cast         []CastMember `json:"Cast"`
+	Director     string       `json:"Director"`
+	ReleaseDate  string       `json:"ReleaseDate"`
+	Language     string       `json:"Language"`
+	Popularity   float64      `json:"Popularity"`
+	Vote         float64      `json:"Vote"`
+	VoteCount    int          `json:"VoteCount"`
+	Post         string       `json:"Post"`
+	HasEmbedding bool         `json:"HasEmbedding"`
+}
+
+var errMovieNotFound = errors.New("movie not found")
+
+func handleMovieDetail(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_id"})
+	}
+	return respondMovie(c, "id", id)
+}
+
+func handleMovieDetailByTmdb(c *fiber.Ctx) error {
+	tmdbID, err := c.ParamsInt("tmdbId")
+	if err != nil || tmdbID <= 0 {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_id"})
+	}
+	return respondMovie(c, "tmdb_id", tmdbID)
+}
+
+func respondMovie(c *fiber.Ctx, column string, id int) error {
+	m, err := loadMovie(c.UserContext(), column, id)
+	if errors.Is(err, errMovieNotFound) {
+		return errorJSON(c, 404, fiber.Map{"error": "movie_not_found"})
+	}
+	if err != nil {
+		field := "movie_id"
+		if column == "tmdb_id" {
+			field = "tmdb_id"
+		}
+		requestLogger(c).Error("movie lookup failed", field, id, "err", err)
+		return serverError(c, err, "database_error")
+	}
+	return c.JSON(m)
+}
+
+// loadMovie reads a movie by "id" or "tmdb_id". column is never user input.
+func loadMovie(ctx context.Context, column string, id int) (*MovieDetail, error) {
+	defer metrics.ObserveQuery("movie_detail", time.Now())
+	query := `
+		SELECT id, tmdb_id, title, title_tr, tagline, tagline_tr, overview, overview_tr,
+		       genres, keywords, cast_list, director, TO_CHAR(release_date, 'YYYY-MM-DD'),
+		       original_language, popularity, vote_average, vote_count, poster_path,
+		       embedding IS NOT NULL
+		FROM movies
+		WHERE ` + column + ` = $1`
+
+	var m MovieDetail
+	var tmdbID, voteCount sql.NullInt64
+	var t, ttr, tg, tgtr, ov, ovtr, dir, rd, lang, p sql.NullString
+	var genres, keywords, cast []byte
+	var pop, vote sql.NullFloat64
+
+	err := db.QueryRowContext(ctx, query, id).Scan(&m.ID, &tmdbID, &t, &ttr, &tg, &tgtr, &ov, &ovtr,
+		&genres, &keywords, &cast, &dir, &rd, &lang, &pop, &vote, &voteCount, &p, &m.HasEmbedding)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMovieNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.TmdbID = int(tmdbID.Int64)
+	m.Title, m.TitleTR = t.String, ttr.String
+	m.Tagline, m.TaglineTR = tg.String, tgtr.String
+	m.Overview, m.OverviewTR = ov.String, ovtr.String
+	m.Director, m.ReleaseDate, m.Language, m.Post = dir.String, rd.String, lang.String, p.String
+	m.Popularity, m.Vote, m.VoteCount = pop.Float64, vote.Float64, int(voteCount.Int64)
+	m.Genres = jsonNames(genres)
+	m.Keywords = jsonNames(keywords)
+	m.Cast = castMembers(cast)
+	return &m, nil
+}
+
+// jsonNames flattens the JSONB lists written by the seeder (["a", "b"]) and
+// by the updater ([{"id": 1, "name": "a"}]) into plain names.
+func jsonNames(raw []byte) []string {
+	names := make([]string, 0)
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return names
+	}
+	for _, item := range items {
+		var s string
+		if json.Unmarshal(item, &s) == nil {
+			names = append(names, s)
+			continue
+		}
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(item, &obj) == nil && obj.Name != "" {
+			names = append(names, obj.Name)
+		}
+	}
+	return names
+}
+
+func castMembers(raw []byte) []CastMember {
+	cast := make([]CastMember, 0)
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return cast
+	}
+	for _, item := range items {
+		var name string
+		if json.Unmarshal(item, &name) == nil {
+			cast = append(cast, CastMember{Name: name})
+			continue
+		}
+		var obj struct {
+			Name      string `json:"name"`
+			Character string `json:"character"`
+		}
+		if json.Unmarshal(item, &obj) == nil && obj.Name != "" {
+			cast = append(cast, CastMember{Name: obj.Name, Character: obj.Character})
+		}
+	}
+	return cast
+}
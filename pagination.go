@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	DefaultResultLimit = 12
+	MaxResultLimit     = 50
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type SearchResponse struct {
+	Results    []MovieResponse `json:"results"`
+	NextCursor *string         `json:"nextCursor"`
+	Total      int             `json:"total"`
+	Limit      int             `json:"limit"`
+}
+
+// pageCursor points at the last row of the previous page. Rows are ordered
+// by (score DESC, id ASC), so the next page starts strictly after this pair.
+type pageCursor struct {
+	Score float64 `json:"s"`
+	ID    int     `json:"i"`
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID <= 0 {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalizeLimit applies the default page size and clamps it to the server
+// side maximum. Negative values are rejected.
+func normalizeLimit(limit int) (int, bool) {
+	switch {
+	case limit < 0:
+		return 0, false
+	case limit == 0:
+		return DefaultResultLimit, true
+	case limit > MaxResultLimit:
+		return MaxResultLimit, true
+	}
+	return limit, true
+}
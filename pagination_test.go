@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, c := range []pageCursor{
+		{Score: 0.8731, ID: 42},
+		{Score: 0, ID: 1},
+		{Score: -0.25, ID: 987654},
+	} {
+		got, err := decodeCursor(encodeCursor(c))
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%+v)) error: %v", c, err)
+		}
+		if *got != c {
+			t.Errorf("round trip = %+v, want %+v", *got, c)
+		}
+	}
+}
+
+func TestDecodeCursorEmpty(t *testing.T) {
+	c, err := decodeCursor("")
+	if c != nil || err != nil {
+		t.Errorf(`decodeCursor("") = %v, %v, want nil, nil`, c, err)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := encodeCursor(pageCursor{Score: 0.5, ID: 7})
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":0.5,"i":70}`))},
+		{"standard alphabet", base64.StdEncoding.EncodeToString([]byte(`{"s":0.5,"i":7}??`))},
+		{"truncated", valid[:len(valid)-3]},
+		{"not json", enc("score=0.5")},
+		{"json array", enc(`[0.5, 7]`)},
+		{"wrong types", enc(`{"s":"high","i":7}`)},
+		{"missing id", enc(`{"s":0.5}`)},
+		{"zero id", enc(`{"s":0.5,"i":0}`)},
+		{"negative id", enc(`{"s":0.5,"i":-3}`)},
+		{"fractional id", enc(`{"s":0.5,"i":7.5}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, errInvalidCursor) {
+				t.Errorf("decodeCursor(%q) = %+v, %v, want errInvalidCursor", tt.cursor, c, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+		ok    bool
+	}{
+		{-1, 0, false},
+		{0, DefaultResultLimit, true},
+		{1, 1, true},
+		{MaxResultLimit, MaxResultLimit, true},
+		{MaxResultLimit + 1, MaxResultLimit, true},
+		{1 << 30, MaxResultLimit, true},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeLimit(tt.limit)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeLimit(%d) = %d, %v, want %d, %v", tt.limit, got, ok, tt.want, tt.ok)
+		}
+	}
+}
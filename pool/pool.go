@@ -0,0 +1,37 @@
+// Package pool runs a function over a list of items with a fixed number of
+// workers. The batch commands use it for their TMDB and embedding calls.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Run calls fn for every item from workers goroutines and waits for the
+// calls to finish. Once ctx is cancelled no new items are started and Run
+// returns the context error.
+func Run[T any](ctx context.Context, workers int, items []T, fn func(context.Context, T)) error {
+	ch := make(chan T)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range ch {
+				fn(ctx, item)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case ch <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ch)
+	wg.Wait()
+	return ctx.Err()
+}
@@ -1,132 +1,83 @@
-package main
+// Package poster refreshes movies.poster_path from the TMDB API.
+package poster
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"sync"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"movie-search-db/catalog"
+	"movie-search-db/metrics"
+	"movie-search-db/pool"
+	"movie-search-db/tmdb"
 )
 
-const (
-	WorkerCount = 20
-	TMDBBaseURL = "https://api.themoviedb.org/3/movie/%d?api_key=%s"
-)
-
-type TMDBMovieResponse struct {
-	PosterPath string `json:"poster_path"`
-}
+const DefaultWorkers = 20
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal(".env dosyasi yuklenemedi")
-	}
+type Options struct {
+	Workers int
+	// TMDB is shared by all workers, it keeps them under the rate limit.
+	TMDB *tmdb.Client
 }
 
-func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
-
-	db, err := sql.Open("postgres", dsn)
+func Run(ctx context.Context, db *sql.DB, opts Options) error {
+	start := time.Now()
+	movies, err := catalog.Refs(ctx, db, "")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("listing movies: %w", err)
 	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
 
-	rows, err := db.Query("SELECT id, tmdb_id FROM movies WHERE tmdb_id IS NOT NULL ORDER BY popularity DESC")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(rows)
-
-	jobs := make(chan [2]int, 100)
-	var wg sync.WaitGroup
-
-	for i := 0; i < WorkerCount; i++ {
-		wg.Add(1)
-		go worker(db, jobs, &wg)
-	}
-
-	for rows.Next() {
-		var id, tmdbID int
-		if err := rows.Scan(&id, &tmdbID); err != nil {
-			continue
-		}
-		jobs <- [2]int{id, tmdbID}
-	}
-
-	close(jobs)
-	wg.Wait()
-	fmt.Println("Poster guncelleme islemi bitti.")
-}
-
-func worker(db *sql.DB, jobs <-chan [2]int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	client := &http.Client{Timeout: 10 * time.Second}
-	apiKey := os.Getenv("TMDB_API_KEY")
-
-	for job := range jobs {
-		dbID := job[0]
-		tmdbID := job[1]
-
-		newPath, err := fetchCurrentPoster(client, tmdbID, apiKey)
-		if err != nil {
-			log.Printf("TMDB ID %d hatasi: %v", tmdbID, err)
-			continue
+	job := metrics.StartJob("posters")
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	err = pool.Run(ctx, opts.Workers, movies, func(ctx context.Context, m catalog.Ref) {
+		newPath, err := fetchCurrentPoster(ctx, opts.TMDB, m.TmdbID)
+		switch {
+		case errors.Is(err, tmdb.ErrUnauthorized):
+			slog.Error("tmdb rejected the api key, stopping", "stage", "fetch", "tmdb_id", m.TmdbID, "err", err)
+			abort(err)
+			job.Failed(1)
+			return
+		case errors.Is(err, tmdb.ErrNotFound):
+			slog.Warn("movie not found on tmdb", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID)
+			job.Skipped(1)
+			return
+		case err != nil:
+			slog.Error("poster update failed", "stage", "fetch", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+			job.Failed(1)
+			return
 		}
 
 		if newPath != "" {
-			_, err = db.Exec("UPDATE movies SET poster_path = $1 WHERE id = $2", newPath, dbID)
+			_, err = db.ExecContext(ctx, "UPDATE movies SET poster_path = $1 WHERE id = $2", newPath, m.ID)
 			if err != nil {
-				log.Printf("DB update hatasi (ID %d): %v", dbID, err)
+				slog.Error("poster update failed", "stage", "update", "movie_id", m.ID, "tmdb_id", m.TmdbID, "err", err)
+				job.Failed(1)
 			} else {
-				fmt.Printf("Film %d guncellendi: %s\n", dbID, newPath)
+				slog.Info("poster updated", "movie_id", m.ID, "tmdb_id", m.TmdbID, "poster_path", newPath)
+				job.OK(1)
 			}
+		} else {
+			job.Skipped(1)
 		}
-
-		time.Sleep(50 * time.Millisecond)
-	}
-}
-
-func fetchCurrentPoster(client *http.Client, tmdbID int, apiKey string) (string, error) {
-	url := fmt.Sprintf(TMDBBaseURL, tmdbID, apiKey)
-	resp, err := client.Get(url)
+	})
+	catalog.BumpIfChanged(ctx, db, "posters", job.Succeeded())
 	if err != nil {
-		return "", err
+		return context.Cause(ctx)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
+	job.Finish()
+	slog.Info("poster update finished", "movies", len(movies), "duration", time.Since(start))
+	return job.Err()
+}
 
-	var res TMDBMovieResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+func fetchCurrentPoster(ctx context.Context, client *tmdb.Client, tmdbID int) (string, error) {
+	res, err := client.Movie(ctx, tmdbID, "en-US")
+	if err != nil || res.PosterPath == nil {
 		return "", err
 	}
-
-	return res.PosterPath, nil
+	return *res.PosterPath, nil
 }
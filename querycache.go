@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"movie-search-db/embedding"
+	"movie-search-db/metrics"
+)
+
+// newQueryCache wraps the embedding provider with the query cache
+// configured in cfg.Cache. Cache counters are exported on /metrics.
+func newQueryCache(provider embedding.Embedder) embedding.Embedder {
+	size := cfg.Cache.EmbeddingSize
+	if size == 0 {
+		return provider
+	}
+
+	var persist *embedding.PostgresCache
+	if cfg.Cache.EmbeddingPersist {
+		persist = embedding.NewPostgresCache(db, cfg.Cache.EmbeddingTTL)
+		n, err := persist.Invalidate(context.Background(), provider.Model())
+		if err != nil {
+			slog.Error("query embedding invalidation failed", "err", err)
+		} else if n > 0 {
+			slog.Info("query embeddings of other models deleted", "deleted", n, "model", provider.Model())
+		}
+		go every(time.Hour, func() {
+			n, err := persist.Prune(context.Background())
+			if err != nil {
+				slog.Error("query embedding prune failed", "err", err)
+				return
+			}
+			if n > 0 {
+				slog.Info("query embeddings pruned", "deleted", n)
+			}
+		})
+	}
+
+	cache := embedding.NewCached(provider, size, cfg.Cache.EmbeddingTTL, persist)
+	metrics.RegisterEmbeddingCache(cache)
+	return cache
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DefaultRankingProfile = "default"
+
+// RankingProfile holds the weights of the search score:
+//
+//	score = sim*Similarity + vote/10*Vote + log(popularity)/10*Popularity + recency*Recency
+//
+// where recency decays from 1 (released today) by half every
+// RecencyHalfLifeYears. Only rows with sim > MinSimilarity and
+// vote_count >= MinVoteCount are ranked.
+type RankingProfile struct {
+	Similarity           float64 `json:"similarity"`
+	Vote                 float64 `json:"vote"`
+	Popularity           float64 `json:"popularity"`
+	Recency              float64 `json:"recency"`
+	RecencyHalfLifeYears float64 `json:"recencyHalfLifeYears"`
+	MinSimilarity        float64 `json:"minSimilarity"`
+	MinVoteCount         int     `json:"minVoteCount"`
+}
+
+type ScoreBreakdown struct {
+	Similarity float64 `json:"Similarity"`
+	Vote       float64 `json:"Vote"`
+	Popularity float64 `json:"Popularity"`
+	Recency    float64 `json:"Recency"`
+}
+
+var defaultProfile = RankingProfile{
+	Similarity:           0.85,
+	Vote:                 0.10,
+	Popularity:           0.05,
+	Recency:              0,
+	RecencyHalfLifeYears: 10,
+	MinSimilarity:        0.35,
+	MinVoteCount:         11,
+}
+
+func (p RankingProfile) Validate() error {
+	if p.Similarity < 0 || p.Vote < 0 || p.Popularity < 0 || p.Recency < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	if p.Similarity+p.Vote+p.Popularity+p.Recency == 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+	if p.RecencyHalfLifeYears <= 0 {
+		return fmt.Errorf("recencyHalfLifeYears must be positive")
+	}
+	if p.MinSimilarity < -1 || p.MinSimilarity > 1 {
+		return fmt.Errorf("minSimilarity must be between -1 and 1")
+	}
+	if p.MinVoteCount < 0 {
+		return fmt.Errorf("minVoteCount must not be negative")
+	}
+	return nil
+}
+
+// loadRankingProfiles returns the built-in default profile merged with the
+// profiles in the JSON file at path (RANKING_PROFILES_FILE), e.g.
+//
+//	{"default": {...}, "recent": {"similarity": 0.7, "recency": 0.15, ...}}
+//
+// Fields missing from a profile in the file fall back to the default profile.
+func loadRankingProfiles(path string) (map[string]RankingProfile, error) {
+	profiles := map[string]RankingProfile{DefaultRankingProfile: defaultProfile}
+
+	if path == "" {
+		return profiles, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileProfiles map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fileProfiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// default first, so other profiles inherit an overridden default
+	if body, ok := fileProfiles[DefaultRankingProfile]; ok {
+		p := defaultProfile
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("ranking profile %s: %w", DefaultRankingProfile, err)
+		}
+		profiles[DefaultRankingProfile] = p
+	}
+	for name, body := range fileProfiles {
+		p := profiles[DefaultRankingProfile]
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("ranking profile %s: %w", name, err)
+		}
+		profiles[strings.ToLower(name)] = p
+	}
+
+	for name, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("ranking profile %s: %w", name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// rankingProfile resolves the profile a request asked for. An empty name
+// selects the default profile.
+func rankingProfile(name string) (RankingProfile, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultRankingProfile
+	}
+	p, ok := rankingProfiles[name]
+	return p, ok
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/ratelimit"
+)
+
+const bucketIdleTTL = time.Hour
+
+var (
+	rateStore      ratelimit.Store
+	ipLimit        ratelimit.Limit
+	trustedProxies []*net.IPNet
+)
+
+// setupRateLimit creates the bucket store (memory or postgres) and the
+// anonymous per-IP limit, and parses the trusted proxy ranges.
+func setupRateLimit() error {
+	switch cfg.RateLimit.Store {
+	case "memory":
+		store := ratelimit.NewMemoryStore()
+		go every(10*time.Minute, func() { store.Cleanup(bucketIdleTTL) })
+		rateStore = store
+	case "postgres":
+		store := ratelimit.NewPostgresStore(db)
+		go every(10*time.Minute, func() {
+			if err := store.Cleanup(context.Background(), bucketIdleTTL); err != nil {
+				slog.Error("rate limit cleanup failed", "err", err)
+			}
+		})
+		rateStore = store
+	default:
+		return errors.New("RATE_LIMIT_STORE must be memory or postgres")
+	}
+
+	ipLimit = ratelimit.PerMinute(cfg.RateLimit.IPPerMinute, cfg.RateLimit.IPBurst)
+
+	for _, cidr := range cfg.Server.TrustedProxies {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		trustedProxies = append(trustedProxies, n)
+	}
+	return nil
+}
+
+func every(d time.Duration, fn func()) {
+	for range time.Tick(d) {
+		fn()
+	}
+}
+
+// ipRateLimit limits anonymous requests per client IP. Requests made with an
+// API key are limited per key in apiKeyAuth instead.
+func ipRateLimit(c *fiber.Ctx) error {
+	if requestAPIKey(c) != nil {
+		return c.Next()
+	}
+	if ok, wait := takeToken(c, "ip:"+clientIP(c), ipLimit); !ok {
+		return tooManyRequests(c, wait, "rate_limited")
+	}
+	return c.Next()
+}
+
+// takeToken takes one token from the named bucket and sets the RateLimit-*
+// headers. If the store is unavailable the request is let through.
+func takeToken(c *fiber.Ctx, key string, limit ratelimit.Limit) (bool, time.Duration) {
+	if limit.Unlimited() {
+		return true, 0
+	}
+	res, err := rateStore.Take(c.UserContext(), key, limit)
+	if err != nil {
+		requestLogger(c).Error("rate limit store failed", "bucket", key, "err", err)
+		return true, 0
+	}
+
+	c.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	return res.Allowed, res.RetryAfter
+}
+
+// clientIP is the address of the caller. Behind cloudflared and other
+// trusted proxies it comes from CF-Connecting-IP or X-Forwarded-For.
+func clientIP(c *fiber.Ctx) string {
+	return forwardedIP(c.IP(), c.Get("CF-Connecting-IP"), c.Get(fiber.HeaderXForwardedFor))
+}
+
+// forwardedIP picks the client address from the peer and the proxy
+// headers. The headers are only read when peer is a trusted proxy; any
+// other caller could set them to pick its own rate limit bucket.
+// X-Forwarded-For is read from the right: each proxy appends the address
+// it got the request from, so the last address that is not a trusted
+// proxy is the client and everything left of it may be forged.
+func forwardedIP(peer, cfConnectingIP, xff string) string {
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+	if ip := strings.TrimSpace(cfConnectingIP); net.ParseIP(ip) != nil {
+		return ip
+	}
+	hops := strings.Split(xff, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(hops[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return peer
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for MemoryStore.now.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = clock.now
+	return s, clock
+}
+
+func take(t *testing.T, s *MemoryStore, key string, l Limit) Result {
+	t.Helper()
+	res, err := s.Take(context.Background(), key, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestMemoryStoreBurstThenDeny(t *testing.T) {
+	s, _ := newTestStore()
+	l := Limit{Rate: 1, Burst: 3}
+
+	for i := range 3 {
+		res := take(t, s, "k", l)
+		if !res.Allowed || res.Remaining != 2-i || res.Limit != 3 {
+			t.Fatalf("take %d = %+v, want allowed with %d remaining", i, res, 2-i)
+		}
+	}
+	res := take(t, s, "k", l)
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("take after burst = %+v, want denied", res)
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", res.RetryAfter)
+	}
+	if res.Reset != 3*time.Second {
+		t.Errorf("Reset = %v, want 3s", res.Reset)
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	s, clock := newTestStore()
+	l := PerMinute(60, 2) // one token per second
+
+	take(t, s, "k", l)
+	take(t, s, "k", l)
+	if take(t, s, "k", l).Allowed {
+		t.Fatal("bucket not empty after burst")
+	}
+
+	clock.advance(500 * time.Millisecond)
+	res := take(t, s, "k", l)
+	if res.Allowed {
+		t.Fatal("allowed after half a token")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", res.RetryAfter)
+	}
+
+	clock.advance(500 * time.Millisecond)
+	if !take(t, s, "k", l).Allowed {
+		t.Fatal("denied after a full token was refilled")
+	}
+
+	// a long idle period refills at most Burst tokens
+	clock.advance(time.Hour)
+	for i := range 2 {
+		if !take(t, s, "k", l).Allowed {
+			t.Fatalf("take %d after idle denied", i)
+		}
+	}
+	if take(t, s, "k", l).Allowed {
+		t.Error("bucket held more than Burst tokens")
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	s, _ := newTestStore()
+	l := Limit{Rate: 1, Burst: 1}
+	take(t, s, "ip:1.1.1.1", l)
+	if take(t, s, "ip:1.1.1.1", l).Allowed {
+		t.Fatal("first key not limited")
+	}
+	if !take(t, s, "ip:2.2.2.2", l).Allowed {
+		t.Error("second key limited by the first")
+	}
+}
+
+func TestMemoryStoreUnlimited(t *testing.T) {
+	s, _ := newTestStore()
+	for _, l := range []Limit{{Rate: 0, Burst: 5}, {Rate: 5, Burst: 0}, PerMinute(0, 0)} {
+		for range 100 {
+			if !take(t, s, "k", l).Allowed {
+				t.Fatalf("limit %+v denied a request", l)
+			}
+		}
+	}
+	if len(s.buckets) != 0 {
+		t.Errorf("unlimited takes created %d buckets", len(s.buckets))
+	}
+}
+
+func TestMemoryStoreCleanup(t *testing.T) {
+	s, clock := newTestStore()
+	l := Limit{Rate: 1, Burst: 1}
+	take(t, s, "old", l)
+	clock.advance(30 * time.Minute)
+	take(t, s, "recent", l)
+	clock.advance(45 * time.Minute)
+
+	s.Cleanup(time.Hour)
+	if _, ok := s.buckets["old"]; ok {
+		t.Error("idle bucket kept")
+	}
+	if _, ok := s.buckets["recent"]; !ok {
+		t.Error("active bucket dropped")
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps the buckets in rate_limit_buckets, so every API
+// instance behind the load balancer shares the same limits.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	if l.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	// refill = min(burst, tokens + elapsed * rate); one token is taken if available
+	const refill = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8)`
+	var tokens float64
+	var allowed bool
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN `+refill+` >= 1 THEN `+refill+` - 1 ELSE `+refill+` END,
+			allowed = `+refill+` >= 1,
+			updated_at = now()
+		RETURNING tokens, allowed`, key, l.Burst, l.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(l, tokens, allowed), nil
+}
+
+// Cleanup deletes buckets idle for longer than idle.
+func (s *PostgresStore) Cleanup(ctx context.Context, idle time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)`,
+		idle.Seconds())
+	return err
+}
@@ -0,0 +1,61 @@
+// Package ratelimit implements token bucket rate limiting with an
+// in-memory store for a single API instance and a Postgres store shared by
+// all instances.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func PerMinute(n, burst int) Limit {
+	if burst <= 0 {
+		burst = n
+	}
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+func (l Limit) Unlimited() bool { return l.Rate <= 0 || l.Burst <= 0 }
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+type Store interface {
+	// Take removes one token from the bucket named key.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result builds a Result from the bucket state after a Take.
+func result(l Limit, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(l.Burst) - tokens) / l.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
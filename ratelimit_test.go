@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func setTrustedProxies(t *testing.T, cidrs ...string) {
+	t.Helper()
+	old := trustedProxies
+	t.Cleanup(func() { trustedProxies = old })
+	trustedProxies = nil
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trustedProxies = append(trustedProxies, n)
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	setTrustedProxies(t, "172.28.0.10/32", "10.0.0.0/8")
+	tests := []struct {
+		name          string
+		peer, cf, xff string
+		want          string
+	}{
+		{"direct client", "203.0.113.5", "", "", "203.0.113.5"},
+		{"untrusted peer cf header ignored", "203.0.113.5", "198.51.100.1", "", "203.0.113.5"},
+		{"untrusted peer xff ignored", "203.0.113.5", "", "198.51.100.1", "203.0.113.5"},
+		{"untrusted peer in trusted-looking range", "172.28.0.11", "198.51.100.1", "198.51.100.1", "172.28.0.11"},
+		{"trusted cf header", "172.28.0.10", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted cf header ipv6", "172.28.0.10", " 2001:db8::1 ", "", "2001:db8::1"},
+		{"trusted cf header wins over xff", "172.28.0.10", "198.51.100.1", "198.51.100.2", "198.51.100.1"},
+		{"trusted invalid cf header falls back to xff", "172.28.0.10", "unknown", "198.51.100.2", "198.51.100.2"},
+		{"trusted xff single", "172.28.0.10", "", "198.51.100.2", "198.51.100.2"},
+		{"trusted xff skips trusted hops", "172.28.0.10", "", "198.51.100.2, 10.1.2.3", "198.51.100.2"},
+		{"trusted xff forged left entry", "172.28.0.10", "", "1.2.3.4, 198.51.100.2", "198.51.100.2"},
+		{"trusted xff garbage", "172.28.0.10", "", "not-an-ip", "172.28.0.10"},
+		{"trusted xff garbage left of client", "172.28.0.10", "", "garbage, 198.51.100.2", "198.51.100.2"},
+		{"trusted no headers", "172.28.0.10", "", "", "172.28.0.10"},
+		{"trusted xff only proxies", "172.28.0.10", "", "10.0.0.1, 10.0.0.2", "172.28.0.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedIP(tt.peer, tt.cf, tt.xff); got != tt.want {
+				t.Errorf("forwardedIP(%q, %q, %q) = %q, want %q", tt.peer, tt.cf, tt.xff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedIPNoTrustedProxies(t *testing.T) {
+	setTrustedProxies(t)
+	if got := forwardedIP("172.28.0.10", "198.51.100.1", "198.51.100.2"); got != "172.28.0.10" {
+		t.Errorf("forwardedIP() = %q, want the peer when nothing is trusted", got)
+	}
+}
+
+// TestClientIPHeaders checks that clientIP reads the request headers; the
+// test requests of fiber come from 0.0.0.0.
+func TestClientIPHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(clientIP(c)) })
+	get := func(header, value string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(header, value)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	setTrustedProxies(t)
+	if got := get("CF-Connecting-IP", "198.51.100.1"); got != "0.0.0.0" {
+		t.Errorf("untrusted peer: clientIP = %q, want 0.0.0.0", got)
+	}
+	setTrustedProxies(t, "0.0.0.0/32")
+	if got := get("CF-Connecting-IP", "198.51.100.1"); got != "198.51.100.1" {
+		t.Errorf("trusted peer: clientIP = %q, want CF-Connecting-IP", got)
+	}
+	if got := get("X-Forwarded-For", "198.51.100.2"); got != "198.51.100.2" {
+		t.Errorf("trusted peer: clientIP = %q, want X-Forwarded-For", got)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/logging"
+)
+
+// localsRequestID is where the requestid middleware keeps the id of the
+// request (taken from X-Request-ID or generated).
+const localsRequestID = "requestid"
+
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(localsRequestID).(string)
+	return id
+}
+
+// requestLog attaches a logger carrying the request id to the request
+// context and writes one record per request when it finishes.
+func requestLog(c *fiber.Ctx) error {
+	start := time.Now()
+	l := slog.Default().With("request_id", requestID(c))
+	c.SetUserContext(logging.WithLogger(c.UserContext(), l))
+
+	err := c.Next()
+
+	status := responseStatus(c, err)
+	level := slog.LevelInfo
+	if status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	l.LogAttrs(c.UserContext(), level, "request",
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.String("route", c.Route().Path),
+		slog.Int("status", status),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("ip", clientIP(c)),
+	)
+	return err
+}
+
+func requestLogger(c *fiber.Ctx) *slog.Logger {
+	return logging.FromContext(c.UserContext())
+}
+
+// errorJSON sends an error body tagged with the request id, so a failed
+// request can be found in the logs.
+func errorJSON(c *fiber.Ctx, status int, body fiber.Map) error {
+	body["requestId"] = requestID(c)
+	return c.Status(status).JSON(body)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"movie-search-db/catalog"
+	"movie-search-db/embedding"
+	"movie-search-db/lru"
+)
+
+const (
+	CacheHit    = "HIT"
+	CacheMiss   = "MISS"
+	CacheBypass = "BYPASS"
+)
+
+// resultCache keeps ranked search responses for a short TTL. Entries are
+// tied to the catalog version, which the batch jobs bump after every data
+// refresh; a new version empties the cache.
+type resultCache struct {
+	lru     *lru.Cache[*SearchResponse]
+	version atomic.Int64
+}
+
+var results *resultCache
+
+// newResultCache creates the cache configured in cfg.Cache; ResultPoll is
+// how often the catalog version is checked. It returns nil when the result
+// cache size is 0.
+func newResultCache() *resultCache {
+	if cfg.Cache.ResultSize == 0 {
+		return nil
+	}
+	rc := &resultCache{lru: lru.New[*SearchResponse](cfg.Cache.ResultSize, cfg.Cache.ResultTTL)}
+
+	if st, err := catalog.Current(context.Background(), db); err == nil {
+		rc.version.Store(st.Version)
+	}
+	go every(cfg.Cache.ResultPoll, rc.refreshVersion)
+	return rc
+}
+
+func (rc *resultCache) refreshVersion() {
+	st, err := catalog.Current(context.Background(), db)
+	if err != nil {
+		slog.Error("catalog version check failed", "err", err)
+		return
+	}
+	if old := rc.version.Swap(st.Version); old != st.Version {
+		rc.lru.Purge()
+		slog.Info("catalog version changed, result cache purged", "from", old, "to", st.Version, "job", st.UpdatedBy)
+	}
+}
+
+// resultCacheKey identifies a search by everything that changes its output.
+func (rc *resultCache) key(req *SearchRequest, opts searchOptions) string {
+	raw, _ := json.Marshal(struct {
+		Version int64
+		Mode    string
+		Query   string
+		Filters SearchFilters
+		Limit   int
+		Cursor  string
+		Profile string
+		Explain bool
+	}{
+		Version: rc.version.Load(),
+		Mode:    req.Mode,
+		Query:   embedding.NormalizeQuery(req.Query),
+		Filters: req.Filters,
+		Limit:   opts.Limit,
+		Cursor:  req.Cursor,
+		Profile: strings.ToLower(strings.TrimSpace(req.Profile)),
+		Explain: req.Explain,
+	})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (rc *resultCache) get(key string) (*SearchResponse, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	return rc.lru.Get(key)
+}
+
+func (rc *resultCache) put(key string, resp *SearchResponse) {
+	if rc != nil {
+		rc.lru.Put(key, resp)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/config"
+	"movie-search-db/logging"
+	"movie-search-db/metrics"
+)
+
+// annConfig controls the approximate nearest neighbour step of a search.
+// Candidates rows are pulled through the vector index and only those are
+// re-ranked with the popularity/vote blend.
+type annConfig struct {
+	Candidates    int
+	EfSearch      int
+	Probes        int
+	IterativeScan string
+}
+
+func newANNConfig(c config.Search) annConfig {
+	cfg := annConfig{
+		Candidates:    c.Candidates,
+		EfSearch:      c.EfSearch,
+		Probes:        c.Probes,
+		IterativeScan: c.IterativeScan,
+	}
+	// hnsw returns at most ef_search rows per scan; pgvector rejects values
+	// above config.MaxEfSearch
+	cfg.EfSearch = min(max(cfg.EfSearch, cfg.Candidates), config.MaxEfSearch)
+	return cfg
+}
+
+// iterative reports whether index scans keep going until enough rows pass
+// the filters.
+func (a annConfig) iterative() bool {
+	return a.IterativeScan != "" && a.IterativeScan != "off"
+}
+
+const (
+	SearchModeVector = "vector"
+	SearchModeHybrid = "hybrid"
+
+	// rrfK is the usual reciprocal rank fusion constant; it dampens the
+	// advantage of the very first ranks of either list.
+	rrfK = "60"
+)
+
+type searchParams struct {
+	Mode    string
+	Query   string
+	Vector  []float32
+	Filters SearchFilters
+	Limit   int
+	Cursor  *pageCursor
+	Profile RankingProfile
+	Explain bool
+
+	// ExcludeID drops one movie from the results, e.g. the source movie
+	// of a similar-movies lookup.
+	ExcludeID int
+}
+
+type searchOptions struct {
+	Limit   int
+	Cursor  *pageCursor
+	Profile RankingProfile
+}
+
+// parseSearchOptions validates the filter, paging and profile parameters
+// shared by every endpoint that returns ranked movies. On failure it
+// returns the body of the 400 response.
+func parseSearchOptions(filters *SearchFilters, limit int, cursor, profile string) (searchOptions, fiber.Map) {
+	var opts searchOptions
+
+	filters.Normalize()
+	if ferr := filters.Validate(); ferr != nil {
+		return opts, fiber.Map{"error": "invalid_filter", "field": ferr.Field, "message": ferr.Message}
+	}
+
+	var ok bool
+	opts.Limit, ok = normalizeLimit(limit)
+	if !ok {
+		return opts, fiber.Map{"error": "invalid_limit", "message": fmt.Sprintf("must be between 1 and %d", MaxResultLimit)}
+	}
+
+	var err error
+	opts.Cursor, err = decodeCursor(cursor)
+	if err != nil {
+		return opts, fiber.Map{"error": "invalid_cursor"}
+	}
+
+	opts.Profile, ok = rankingProfile(profile)
+	if !ok {
+		return opts, fiber.Map{"error": "unknown_profile", "field": "profile"}
+	}
+	return opts, nil
+}
+
+func respondSearch(c *fiber.Ctx, resp *SearchResponse) error {
+	if resp.Total == 0 {
+		return c.Status(404).JSON(fiber.Map{"message": "no_results", "results": []MovieResponse{}, "nextCursor": nil, "total": 0, "limit": resp.Limit})
+	}
+	return c.JSON(resp)
+}
+
+func runSearch(ctx context.Context, p searchParams) (*SearchResponse, error) {
+	defer metrics.ObserveQuery("search", time.Now())
+	vectorJSON, _ := json.Marshal(p.Vector)
+
+	var args sqlArgs
+	vec := args.add(string(vectorJSON)) + "::vector"
+	filterSQL, filterArgs := p.Filters.SQL(len(args))
+	args = append(args, filterArgs...)
+	eligible := "embedding IS NOT NULL\n      AND vote_count >= " + args.add(p.Profile.MinVoteCount) + filterSQL
+	if p.ExcludeID > 0 {
+		eligible += "\n      AND id <> " + args.add(p.ExcludeID)
+	}
+	candidates := args.add(ann.Candidates)
+	// Without iterative scans an index scan stops after ef_search rows,
+	// before the filters run, and could drop matching movies.
+	filtered := filterSQL != "" || p.ExcludeID > 0 || p.Profile.MinVoteCount > 0
+	exact := filtered && !ann.iterative()
+
+	var matches, threshold string
+	switch p.Mode {
+	case SearchModeHybrid:
+		// Reciprocal rank fusion of the vector and full-text rankings,
+		// scaled so a movie ranked first by both gets relevance 1.
+		q := args.add(p.Query)
+		matches = `VectorHits AS (
+    SELECT id, embedding <=> ` + vec + ` AS distance
+    FROM movies
+    WHERE ` + eligible + `
+    ORDER BY embedding <=> ` + vec + `
+    LIMIT ` + candidates + `
+),
+VectorRanks AS (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY distance, id) AS rank FROM VectorHits
+),
+TextQuery AS (
+    SELECT websearch_to_tsquery('simple', ` + q + `) || websearch_to_tsquery('english', ` + q + `) || websearch_to_tsquery('turkish', ` + q + `) AS tsq
+),
+TextHits AS (
+    SELECT id, ts_rank_cd(search_vector, tsq) AS text_rank
+    FROM movies, TextQuery
+    WHERE search_vector @@ tsq
+      AND ` + eligible + `
+    ORDER BY text_rank DESC, id
+    LIMIT ` + candidates + `
+),
+TextRanks AS (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY text_rank DESC, id) AS rank FROM TextHits
+),
+Matches AS (
+    SELECT 
+        COALESCE(v.id, t.id) AS id,
+        (COALESCE(1.0 / (` + rrfK + ` + v.rank), 0) + COALESCE(1.0 / (` + rrfK + ` + t.rank), 0)) * (` + rrfK + ` + 1) / 2.0 AS relevance,
+        t.id IS NOT NULL AS text_match
+    FROM VectorRanks v
+    FULL OUTER JOIN TextRanks t ON t.id = v.id
+)`
+		// exact title/cast hits are kept even when the vectors disagree
+		threshold = "sim > " + args.add(p.Profile.MinSimilarity) + "::float8 OR text_match"
+	default:
+		matches = `VectorHits AS (
+    SELECT id, embedding <=> ` + vec + ` AS distance
+    FROM movies
+    WHERE ` + eligible + `
+    ORDER BY embedding <=> ` + vec + `
+    LIMIT ` + candidates + `
+),
+Matches AS (
+    SELECT id, (1 - distance) AS relevance, FALSE AS text_match FROM VectorHits
+)`
+		threshold = "sim > " + args.add(p.Profile.MinSimilarity) + "::float8"
+	}
+
+	pr := p.Profile
+	simW, voteW, popW := args.add(pr.Similarity), args.add(pr.Vote), args.add(pr.Popularity)
+	recencyW, halfLife := args.add(pr.Recency), args.add(pr.RecencyHalfLifeYears)
+
+	cursorSQL := ""
+	if p.Cursor != nil {
+		score, id := args.add(p.Cursor.Score), args.add(p.Cursor.ID)
+		cursorSQL = "\n    WHERE score < " + score + " OR (score = " + score + " AND id > " + id + ")"
+	}
+	limit := args.add(p.Limit + 1)
+
+	query := `WITH ` + matches + `,
+MatchData AS (
+    SELECT 
+        mv.id, 
+        mv.tmdb_id, 
+        COALESCE(NULLIF(TRIM(mv.title_tr), ''), mv.title) AS title,
+        COALESCE(NULLIF(TRIM(mv.tagline_tr), ''), mv.tagline) AS tagline,
+        COALESCE(NULLIF(TRIM(mv.overview_tr), ''), mv.overview) AS overview,
+        mv.poster_path, 
+        mv.vote_average,
+        mv.popularity,
+        mv.release_date,
+        (1 - (mv.embedding <=> ` + vec + `)) AS sim,
+        m.relevance,
+        m.text_match
+    FROM Matches m
+    JOIN movies mv ON mv.id = m.id
+),
+Parts AS (
+    SELECT 
+        id, 
+        tmdb_id, 
+        title, 
+        tagline, 
+        overview, 
+        poster_path, 
+        vote_average,
+        sim,
+        relevance * ` + simW + `::float8 AS sim_part,
+        (vote_average / 10.0) * ` + voteW + `::float8 AS vote_part,
+        LOG(GREATEST(popularity, 1.0)) / 10.0 * ` + popW + `::float8 AS pop_part,
+        COALESCE(EXP(LN(0.5) * GREATEST(CURRENT_DATE - release_date, 0) / 365.25 / ` + halfLife + `::float8), 0) * ` + recencyW + `::float8 AS recency_part
+    FROM MatchData
+    WHERE ` + threshold + `
+),
+Ranked AS (
+    SELECT *, (sim_part + vote_part + pop_part + recency_part) AS score FROM Parts
+)
+SELECT c.total, p.id, p.tmdb_id, p.title, p.tagline, p.overview, p.poster_path, p.vote_average, p.sim, p.score,
+       p.sim_part, p.vote_part, p.pop_part, p.recency_part
+FROM (SELECT COUNT(*) AS total FROM Ranked) c
+LEFT JOIN LATERAL (
+    SELECT * FROM Ranked` + cursorSQL + `
+    ORDER BY score DESC, id ASC
+    LIMIT ` + limit + `
+) p ON TRUE
+ORDER BY p.score DESC, p.id ASC;`
+
+	explain := p.Explain
+	resp := &SearchResponse{Results: make([]MovieResponse, 0, p.Limit), Limit: p.Limit}
+	err := withANN(ctx, exact, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer logging.CloseQuietly(rows)
+
+		for rows.Next() {
+			var m MovieResponse
+			var id, tmdbID sql.NullInt64
+			var t, tg, ov, p sql.NullString
+			var vote, sim, score sql.NullFloat64
+			var b ScoreBreakdown
+			if err := rows.Scan(&resp.Total, &id, &tmdbID, &t, &tg, &ov, &p, &vote, &sim, &score,
+				nullFloat{&b.Similarity}, nullFloat{&b.Vote}, nullFloat{&b.Popularity}, nullFloat{&b.Recency}); err != nil || !id.Valid {
+				continue
+			}
+			m.ID = int(id.Int64)
+			m.TmdbID = int(tmdbID.Int64)
+			m.Title = t.String
+			m.Tag = tg.String
+			m.Ov = ov.String
+			m.Post = p.String
+			m.Vote = vote.Float64
+			m.Sim = sim.Float64
+			m.Score = score.Float64
+			if explain {
+				m.Breakdown = &b
+			}
+			resp.Results = append(resp.Results, m)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.SearchResults.WithLabelValues(p.Mode).Observe(float64(resp.Total))
+
+	if len(resp.Results) > p.Limit {
+		resp.Results = resp.Results[:p.Limit]
+		last := resp.Results[p.Limit-1]
+		next := encodeCursor(pageCursor{Score: last.Score, ID: last.ID})
+		resp.NextCursor = &next
+	}
+	return resp, nil
+}
+
+// withANN runs fn in a read-only transaction with the index scan settings
+// applied through SET LOCAL, so they never leak into pooled connections.
+// With exact set index scans are disabled and the vector ranking is
+// computed over every row.
+func withANN(ctx context.Context, exact bool, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	settings := []string{
+		fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", ann.EfSearch),
+		fmt.Sprintf("SET LOCAL ivfflat.probes = %d", ann.Probes),
+	}
+	if ann.iterative() {
+		// pgvector >= 0.8: keep scanning the index until enough rows pass the
+		// filters. off is the pgvector default and is not set, so it also
+		// works on older versions.
+		settings = append(settings, fmt.Sprintf("SET LOCAL hnsw.iterative_scan = %s", ann.IterativeScan))
+		if ann.IterativeScan != "strict_order" {
+			settings = append(settings, fmt.Sprintf("SET LOCAL ivfflat.iterative_scan = %s", ann.IterativeScan))
+		}
+	}
+	if exact {
+		settings = append(settings, "SET LOCAL enable_indexscan = off")
+	}
+	for _, stmt := range settings {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullFloat scans a nullable float column, leaving 0 for NULL.
+type nullFloat struct{ dst *float64 }
+
+func (n nullFloat) Scan(src any) error {
+	var f sql.NullFloat64
+	if err := f.Scan(src); err != nil {
+		return err
+	}
+	*n.dst = f.Float64
+	return nil
+}
+
+// sqlArgs collects query arguments and hands out their placeholders.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+
+	"movie-search-db/config"
+	"movie-search-db/database"
+	"movie-search-db/migrations"
+)
+
+// Fixture movies of TestFilteredSearchMatchesExactScan, identified by their
+// tmdb ids. filteredMovies of them have the language the test filters on.
+const (
+	fixtureTmdbID  = 990000
+	fixtureMovies  = 300
+	filteredMovies = 15
+	embeddingDims  = 1024
+)
+
+// openTestDB connects the package database to TEST_DATABASE_URL and applies
+// the migrations, or skips the test when it is not set. The pool holds one
+// connection so session settings reach the queries of the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	var err error
+	db, err = database.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := migrations.Up(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func randomVector(r *rand.Rand) string {
+	v := make([]float32, embeddingDims)
+	for i := range v {
+		v[i] = r.Float32()*2 - 1
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+// TestFilteredSearchMatchesExactScan checks that a filter matching few
+// movies returns the same movies as ranking every row, both with iterative
+// index scans and with the exact fallback used without them. It needs
+// pgvector 0.8 or newer in TEST_DATABASE_URL.
+func TestFilteredSearchMatchesExactScan(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	cleanup := func() {
+		_, err := db.ExecContext(ctx, `DELETE FROM movies WHERE tmdb_id >= $1 AND tmdb_id < $2`,
+			fixtureTmdbID, fixtureTmdbID+fixtureMovies)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range fixtureMovies {
+		lang := "qx"
+		if i%(fixtureMovies/filteredMovies) == 0 {
+			lang = "qq"
+		}
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO movies (tmdb_id, title, original_language, vote_average, vote_count, popularity, embedding)
+			VALUES ($1, 'fixture', $2, 5, 100, 1, $3::vector)`, fixtureTmdbID+i, lang, randomVector(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `ANALYZE movies`); err != nil {
+		t.Fatal(err)
+	}
+	// make the planner use the hnsw index whenever it may
+	if _, err := db.ExecContext(ctx, `SET enable_seqscan = off`); err != nil {
+		t.Fatal(err)
+	}
+
+	query := randomVector(r)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id FROM movies
+		WHERE embedding IS NOT NULL AND original_language = 'qq'
+		ORDER BY embedding <=> $1::vector, id
+		LIMIT 10`, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var vector []float32
+	if err := json.Unmarshal([]byte(query), &vector); err != nil {
+		t.Fatal(err)
+	}
+	// rank by similarity alone so the order matches the exact query
+	profile := RankingProfile{Similarity: 1, RecencyHalfLifeYears: 10, MinSimilarity: -1}
+
+	for _, scan := range []string{"relaxed_order", "off"} {
+		t.Run(scan, func(t *testing.T) {
+			ann = newANNConfig(config.Search{Candidates: 20, EfSearch: 20, Probes: 1, IterativeScan: scan})
+			resp, err := runSearch(ctx, searchParams{
+				Mode:    SearchModeVector,
+				Vector:  vector,
+				Filters: SearchFilters{Language: "qq"},
+				Limit:   10,
+				Profile: profile,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, m := range resp.Results {
+				got = append(got, m.ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("results = %v, want %v", got, want)
+			}
+			if resp.Total != filteredMovies {
+				t.Errorf("total = %d, want %d", resp.Total, filteredMovies)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/analytics"
+	"movie-search-db/embedding"
+)
+
+var (
+	searchLog     *analytics.Logger
+	searchLogSalt string
+)
+
+// setupSearchLog starts the search log configured in cfg.SearchLog.
+// Without SEARCH_LOG_SALT the salt stored in the database is used, an
+// unsalted IP hash could be reversed by trying every address. Entries
+// older than the retention are deleted once an hour.
+func setupSearchLog(ctx context.Context) error {
+	if !cfg.SearchLog.Enabled {
+		return nil
+	}
+	searchLogSalt = cfg.SearchLog.Salt
+	if searchLogSalt == "" {
+		salt, err := analytics.Salt(ctx, db)
+		if err != nil {
+			return fmt.Errorf("search log salt: %w", err)
+		}
+		searchLogSalt = salt
+	}
+	searchLog = analytics.NewLogger(db, cfg.SearchLog.Buffer)
+
+	retention := cfg.SearchLog.Retention
+	go every(time.Hour, func() {
+		n, err := analytics.Prune(context.Background(), db, retention)
+		if err != nil {
+			slog.Error("search log prune failed", "err", err)
+			return
+		}
+		if n > 0 {
+			slog.Info("search log pruned", "deleted", n)
+		}
+	})
+	return nil
+}
+
+func logSearch(c *fiber.Ctx, req *SearchRequest, resp *SearchResponse, start time.Time, cacheHit bool) {
+	if searchLog == nil {
+		return
+	}
+
+	profile := strings.ToLower(strings.TrimSpace(req.Profile))
+	if profile == "" {
+		profile = DefaultRankingProfile
+	}
+	e := analytics.Entry{
+		Time:        start,
+		Query:       embedding.NormalizeQuery(req.Query),
+		Mode:        req.Mode,
+		Profile:     profile,
+		Filters:     req.Filters,
+		ResultIDs:   make([]int64, 0, len(resp.Results)),
+		Total:       resp.Total,
+		Latency:     time.Since(start),
+		CacheHit:    cacheHit,
+		ZeroResults: resp.Total == 0,
+		ClientHash:  analytics.HashClient(searchLogSalt, clientIP(c)),
+	}
+	for _, m := range resp.Results {
+		e.ResultIDs = append(e.ResultIDs, int64(m.ID))
+	}
+	if len(resp.Results) > 0 {
+		top := resp.Results[0].Score
+		e.TopScore = &top
+	}
+	if key := requestAPIKey(c); key != nil {
+		e.APIKeyID = &key.ID
+	}
+	searchLog.Log(e)
+}
+
+// adminOnly lets through requests authenticated with an admin API key.
+func adminOnly(c *fiber.Ctx) error {
+	key := requestAPIKey(c)
+	if key == nil {
+		return errorJSON(c, 401, fiber.Map{"error": "api_key_required"})
+	}
+	if !key.Admin {
+		return errorJSON(c, 403, fiber.Map{"error": "admin_required"})
+	}
+	return c.Next()
+}
+
+// handleSearchStats reports on the searches of the last window
+// (?window=24h&top=20).
+func handleSearchStats(c *fiber.Ctx) error {
+	window := 24 * time.Hour
+	if raw := strings.TrimSpace(c.Query("window")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return errorJSON(c, 400, fiber.Map{"error": "invalid_window", "field": "window"})
+		}
+		window = d
+	}
+	top := c.QueryInt("top", 20)
+	if top < 1 || top > 200 {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_top", "field": "top"})
+	}
+
+	report, err := analytics.BuildReport(c.UserContext(), db, window, top)
+	if err != nil {
+		requestLogger(c).Error("search stats failed", "err", err)
+		return serverError(c, err, "database_error")
+	}
+	return c.JSON(report)
+}
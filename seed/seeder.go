@@ -1,95 +1,54 @@
-package main
+// Package seed loads the Kaggle movies dataset (movies_metadata.csv,
+// keywords.csv and credits.csv) into the movies table.
+package seed
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"movie-search-db/catalog"
+	"movie-search-db/logging"
+	"movie-search-db/metrics"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Println(".env dosyasi yuklenemedi")
-	}
+type Options struct {
+	// DataDir holds the dataset CSV files.
+	DataDir string
 }
 
-func main() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_SSLMODE"))
+// Run upserts every movie of the dataset and rebuilds the full-text search
+// documents. Rows that fail to insert are logged and skipped.
+func Run(ctx context.Context, db *sql.DB, opts Options) error {
+	start := time.Now()
+	job := metrics.StartJob("seed")
+	// also after an interrupt or a failed step: rows written so far are in
+	// the catalog
+	defer func() { catalog.BumpIfChanged(ctx, db, "seed", job.Succeeded()) }()
 
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		log.Fatalf("DB baglanti hatasi: %v", err)
-	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(db)
-
-	if err := db.Ping(); err != nil {
-		log.Fatalf("DB erisim hatasi: %v", err)
-	}
+	keywordsMap := loadKeywords(opts.DataDir)
+	castMap, directorsMap := loadCredits(opts.DataDir)
 
-	// Tablo oluşturma bloğu
-	createTableSQL := `
-    CREATE EXTENSION IF NOT EXISTS vector;
-    CREATE TABLE IF NOT EXISTS movies (
-        id SERIAL PRIMARY KEY,
-        tmdb_id INTEGER UNIQUE,
-        title TEXT,
-        title_tr TEXT,
-        tagline TEXT,
-        tagline_tr TEXT,
-        overview TEXT,
-        overview_tr TEXT,
-        genres JSONB,
-        keywords JSONB,
-        cast_list JSONB,
-        director TEXT,
-        release_date DATE,
-        popularity DOUBLE PRECISION,
-        vote_average DOUBLE PRECISION,
-        vote_count INTEGER,
-        original_language TEXT,
-        poster_path TEXT,
-        embedding vector(1024)
-    );`
-	_, err = db.Exec(createTableSQL)
+	file, err := os.Open(filepath.Join(opts.DataDir, "movies_metadata.csv"))
 	if err != nil {
-		log.Fatalf("Tablo olusturma hatasi: %v", err)
+		return err
 	}
-
-	keywordsMap := loadKeywords()
-	castMap, directorsMap := loadCredits()
-
-	file, err := os.Open("datas/movies_metadata.csv")
-	if err != nil {
-		log.Fatalf("CSV acilamadi: %v", err)
-	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(file)
+	defer logging.CloseQuietly(file)
 
 	reader := csv.NewReader(file)
 	reader.LazyQuotes = true
 	header, err := reader.Read()
 	if err != nil {
-		log.Fatalf("Header okunamadi: %v", err)
+		return fmt.Errorf("reading csv header: %w", err)
 	}
 
 	colMap := make(map[string]int)
@@ -107,29 +66,26 @@ func main() {
           tagline = CASE WHEN movies.tagline IS NULL OR movies.tagline = '' THEN EXCLUDED.tagline ELSE movies.tagline END,
           overview = CASE WHEN movies.overview IS NULL OR movies.overview = '' THEN EXCLUDED.overview ELSE movies.overview END
     `
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
-		log.Fatalf("Statement hatasi: %v", err)
+		return err
 	}
-	defer func(stmt *sql.Stmt) {
-		err := stmt.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(stmt)
+	defer logging.CloseQuietly(stmt)
 
 	count := 0
-	for {
+	for ctx.Err() == nil {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			job.Skipped(1)
 			continue
 		}
 
 		tmdbID, _ := strconv.Atoi(record[colMap["id"]])
 		if tmdbID == 0 {
+			job.Skipped(1)
 			continue
 		}
 
@@ -151,34 +107,46 @@ func main() {
 		cJSON, _ := json.Marshal(castMap[tmdbID])
 		director := directorsMap[tmdbID]
 
-		_, err = stmt.Exec(tmdbID, record[colMap["title"]], record[colMap["tagline"]], record[colMap["overview"]],
+		_, err = stmt.ExecContext(ctx, tmdbID, record[colMap["title"]], record[colMap["tagline"]], record[colMap["overview"]],
 			genresJSON, kJSON, cJSON, director, releaseDate, pop, vote, record[colMap["original_language"]], vCount)
 
 		if err != nil {
-			log.Printf("ID %d yazma hatasi: %v", tmdbID, err)
+			slog.Error("movie write failed", "stage", "insert", "tmdb_id", tmdbID, "err", err)
+			job.Failed(1)
 			continue
 		}
 
+		job.OK(1)
 		count++
 		if count%2000 == 0 {
-			fmt.Printf("%d film verisi islendi\n", count)
+			slog.Info("progress", "stage", "insert", "movies", count, "duration", time.Since(start))
 		}
 	}
-	fmt.Printf("Islem tamamlandi. Toplam %d film güncellendi/eklendi.\n", count)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Tam metin arama dokumanini yeni/guncellenen satirlar icin yeniden uret
+	_, err = db.ExecContext(ctx, `UPDATE movies SET search_vector = movie_search_vector(title, title_tr, overview, overview_tr, keywords, cast_list)`)
+	if err != nil {
+		return fmt.Errorf("updating search vectors: %w", err)
+	}
+	job.Finish()
+	slog.Info("seed finished", "movies", count, "duration", time.Since(start))
+	if count == 0 {
+		return fmt.Errorf("no movies were written")
+	}
+	return nil
 }
 
-func loadKeywords() map[int][]string {
+func loadKeywords(dir string) map[int][]string {
 	m := make(map[int][]string)
-	f, err := os.Open("datas/keywords.csv")
+	f, err := os.Open(filepath.Join(dir, "keywords.csv"))
 	if err != nil {
 		return m
 	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(f)
+	defer logging.CloseQuietly(f)
 
 	r := csv.NewReader(f)
 	_, err = r.Read()
@@ -204,19 +172,14 @@ func loadKeywords() map[int][]string {
 	return m
 }
 
-func loadCredits() (map[int][]string, map[int]string) {
+func loadCredits(dir string) (map[int][]string, map[int]string) {
 	castM := make(map[int][]string)
 	dirM := make(map[int]string)
-	f, err := os.Open("datas/credits.csv")
+	f, err := os.Open(filepath.Join(dir, "credits.csv"))
 	if err != nil {
 		return castM, dirM
 	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(f)
+	defer logging.CloseQuietly(f)
 
 	r := csv.NewReader(f)
 	_, err = r.Read()
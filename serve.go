@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"movie-search-db/apikeys"
+	"movie-search-db/captcha"
+	"movie-search-db/embedding"
+	"movie-search-db/metrics"
+)
+
+// cancelDrainTimeout bounds the wait for handlers after their contexts were
+// cancelled at shutdown. docker-compose's stop_grace_period leaves room for
+// it after SHUTDOWN_TIMEOUT.
+const cancelDrainTimeout = 5 * time.Second
+
+func runServe(ctx context.Context, args []string) error {
+	fs := newFlagSet("serve", "")
+	addr := fs.String("addr", cfg.Server.Addr, "dinlenecek adres (LISTEN_ADDR)")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := validate(cfg.ValidateServe); err != nil {
+		return err
+	}
+
+	var err error
+	db, err = openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	metrics.RegisterDB(db, "movies")
+
+	captchaCfg := cfg.CaptchaConfig()
+	verifier, err = captcha.New(captchaCfg)
+	if err != nil {
+		return fmt.Errorf("invalid captcha config: %w", err)
+	}
+	verifier = metrics.Verifier(verifier, captchaCfg.Provider)
+	apiKeyStore = apikeys.NewStore(db)
+	if err := setupRateLimit(); err != nil {
+		return fmt.Errorf("invalid rate limit config: %w", err)
+	}
+
+	ann = newANNConfig(cfg.Search)
+	rankingProfiles, err = loadRankingProfiles(cfg.Server.RankingProfilesFile)
+	if err != nil {
+		return fmt.Errorf("invalid ranking profiles: %w", err)
+	}
+
+	provider, err := embedding.New(cfg.EmbeddingConfig())
+	if err != nil {
+		return fmt.Errorf("invalid embedding config: %w", err)
+	}
+	if err := embedding.CheckColumn(ctx, db, provider); err != nil {
+		return err
+	}
+	embeddingProvider = provider
+	embedder = newQueryCache(metrics.Embedder(provider))
+	results = newResultCache()
+	if err := setupSearchLog(ctx); err != nil {
+		return err
+	}
+
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: false,
+		ReadTimeout:           cfg.Server.ReadTimeout,
+	})
+
+	app.Use(requestid.New(requestid.Config{ContextKey: localsRequestID}))
+	app.Use(requestTimeout(cfg.Server.RequestTimeout))
+	app.Use(requestLog)
+	app.Use(httpMetrics)
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  cfg.Server.CORSAllowOrigins,
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-API-Key",
+		ExposeHeaders: "X-Request-ID, X-Cache, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset",
+	}))
+
+	app.Get("/healthz", handleHealthz)
+	app.Get("/readyz", handleReadyz)
+
+	// /metrics and /version describe the deployment. They get their own
+	// listener on METRICS_ADDR, which the tunnel does not reach; without
+	// it only admin keys may read them.
+	var internal *fiber.App
+	if cfg.Metrics.Addr != "" {
+		internal = fiber.New(fiber.Config{DisableStartupMessage: true, ReadTimeout: cfg.Server.ReadTimeout})
+		addInternalRoutes(internal)
+	} else {
+		addInternalRoutes(app, apiKeyAuth, adminOnly)
+	}
+
+	api := app.Group("/api", apiKeyAuth)
+	api.Post("/search", ipRateLimit, handleSearch)
+	api.Get("/movies/tmdb/:tmdbId", handleMovieDetailByTmdb)
+	api.Get("/movies/:id", handleMovieDetail)
+	api.Get("/movies/:id/similar", ipRateLimit, handleSimilar)
+	api.Get("/admin/search-stats", adminOnly, handleSearchStats)
+
+	listenErr := make(chan error, 2)
+	go func() { listenErr <- app.Listen(*addr) }()
+	if internal != nil {
+		go func() { listenErr <- internal.Listen(cfg.Metrics.Addr) }()
+	}
+
+	select {
+	case err := <-listenErr:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let running requests finish. Whatever
+	// is still running after SHUTDOWN_TIMEOUT is cancelled, and the
+	// database pool is only closed once those handlers have returned.
+	timeout := cfg.Server.ShutdownTimeout
+	slog.Info("shutting down", "timeout", timeout)
+	if err := app.ShutdownWithTimeout(timeout); err != nil {
+		slog.Warn("requests still running after shutdown timeout, cancelling them", "err", err)
+	}
+	if internal != nil {
+		if err := internal.ShutdownWithTimeout(timeout); err != nil {
+			slog.Warn("metrics listener shutdown failed", "err", err)
+		}
+	}
+	cancelServer()
+	if !waitInFlight(cancelDrainTimeout) {
+		slog.Error("handlers still running after cancellation, closing the database anyway", "waited", cancelDrainTimeout)
+	}
+	if searchLog != nil {
+		searchLog.Close()
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// addInternalRoutes registers /metrics and /version on router, behind
+// middleware.
+func addInternalRoutes(router fiber.Router, middleware ...fiber.Handler) {
+	router.Get("/metrics", append(middleware, adaptor.HTTPHandler(promhttp.Handler()))...)
+	router.Get("/version", append(middleware, handleVersion)...)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestInternalRoutesNeedAdminKeyOnAPIPort(t *testing.T) {
+	app := fiber.New()
+	addInternalRoutes(app, apiKeyAuth, adminOnly)
+	for _, path := range []string{"/metrics", "/version"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("GET %s without a key = %d, want 401", path, resp.StatusCode)
+		}
+	}
+}
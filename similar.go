@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"movie-search-db/metrics"
+)
+
+var errEmbeddingMissing = errors.New("movie has no embedding")
+
+type similarQuery struct {
+	Limit   int    `query:"limit"`
+	Cursor  string `query:"cursor"`
+	Profile string `query:"profile"`
+	Explain bool   `query:"explain"`
+}
+
+// handleSimilar returns the nearest neighbours of a movie's stored
+// embedding, ranked with the same blend as search. It never calls the
+// embedding provider, so it needs no captcha.
+func handleSimilar(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_id"})
+	}
+
+	var q similarQuery
+	var filters SearchFilters
+	if err := c.QueryParser(&q); err != nil {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_request"})
+	}
+	if err := c.QueryParser(&filters); err != nil {
+		return errorJSON(c, 400, fiber.Map{"error": "invalid_request"})
+	}
+
+	opts, errBody := parseSearchOptions(&filters, q.Limit, q.Cursor, q.Profile)
+	if errBody != nil {
+		return errorJSON(c, 400, errBody)
+	}
+
+	vector, err := storedEmbedding(c.UserContext(), id)
+	switch {
+	case errors.Is(err, errMovieNotFound):
+		return errorJSON(c, 404, fiber.Map{"error": "movie_not_found"})
+	case errors.Is(err, errEmbeddingMissing):
+		return errorJSON(c, 409, fiber.Map{"error": "embedding_missing", "message": "movie has not been embedded yet"})
+	case err != nil:
+		requestLogger(c).Error("similar search failed", "stage", "stored_embedding", "movie_id", id, "err", err)
+		return serverError(c, err, "database_error")
+	}
+
+	resp, err := runSearch(c.UserContext(), searchParams{
+		Mode:      SearchModeVector,
+		Vector:    vector,
+		Filters:   filters,
+		Limit:     opts.Limit,
+		Cursor:    opts.Cursor,
+		Profile:   opts.Profile,
+		Explain:   q.Explain,
+		ExcludeID: id,
+	})
+	if err != nil {
+		requestLogger(c).Error("similar search failed", "stage", "query", "movie_id", id, "err", err)
+		return serverError(c, err, "database_error")
+	}
+
+	return respondSearch(c, resp)
+}
+
+// storedEmbedding reads movies.embedding. pgvector's text form ("[1,2,3]")
+// is valid JSON.
+func storedEmbedding(ctx context.Context, id int) ([]float32, error) {
+	defer metrics.ObserveQuery("stored_embedding", time.Now())
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT embedding::text FROM movies WHERE id = $1`, id).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMovieNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !raw.Valid {
+		return nil, errEmbeddingMissing
+	}
+
+	var vec []float32
+	if err := json.Unmarshal([]byte(raw.String), &vec); err != nil {
+		return nil, err
+	}
+	return vec, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"movie-search-db/analytics"
+)
+
+// runStats reports on and prunes search_log:
+//
+//	report    summary of the recent searches, the most searched queries and
+//	          the queries without results
+//	prune     deletes the records older than the retention
+func runStats(ctx context.Context, args []string) error {
+	fs := newFlagSet("stats", "report [-window 24h] [-top 20] | prune [-retention 2160h]")
+	dsn := dsnFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	action := fs.Arg(0)
+	sub := newFlagSet("stats "+action, "")
+	var window, retention *time.Duration
+	var top *int
+	switch action {
+	case "report":
+		window = sub.Duration("window", 24*time.Hour, "rapor penceresi (or. 1h, 24h, 168h)")
+		top = sub.Int("top", 20, "listelenecek sorgu sayisi")
+		if err := parseFlags(sub, fs.Args()[1:]); err != nil {
+			return err
+		}
+		if *window <= 0 || *top <= 0 {
+			return fmt.Errorf("%w: -window and -top must be positive", errUsage)
+		}
+	case "prune":
+		retention = sub.Duration("retention", cfg.SearchLog.Retention, "bu sureden eski kayitlar silinir (SEARCH_LOG_RETENTION)")
+		if err := parseFlags(sub, fs.Args()[1:]); err != nil {
+			return err
+		}
+		if *retention <= 0 {
+			return fmt.Errorf("%w: -retention must be positive", errUsage)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: unknown stats command %q", errUsage, action)
+	}
+
+	db, err := openDB(ctx, *dsn, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	if action == "prune" {
+		n, err := analytics.Prune(ctx, db, *retention)
+		if err != nil {
+			return fmt.Errorf("prune search log: %w", err)
+		}
+		fmt.Printf("%d kayit silindi.\n", n)
+		return nil
+	}
+	report, err := analytics.BuildReport(ctx, db, *window, *top)
+	if err != nil {
+		return fmt.Errorf("build report: %w", err)
+	}
+	printReport(report)
+	return nil
+}
+
+func printReport(r *analytics.Report) {
+	fmt.Printf("Baslangic:          %s\n", r.Since.Format("2006-01-02 15:04"))
+	fmt.Printf("Arama sayisi:       %d\n", r.Searches)
+	fmt.Printf("Farkli istemci:     %d\n", r.UniqueClients)
+	fmt.Printf("Sonucsuz arama:     %d\n", r.ZeroResults)
+	fmt.Printf("Cache isabet orani: %.1f%%\n", r.CacheHitRate*100)
+	fmt.Printf("Ortalama sure:      %.1f ms (p95 %.1f ms)\n", r.AvgLatencyMs, r.P95LatencyMs)
+
+	printQueries("En cok aranan sorgular", r.TopQueries)
+	printQueries("Sonucsuz kalan sorgular", r.ZeroQueries)
+}
+
+func printQueries(title string, list []analytics.QueryCount) {
+	fmt.Printf("\n%s:\n", title)
+	if len(list) == 0 {
+		fmt.Println("  (kayit yok)")
+		return
+	}
+	for _, q := range list {
+		fmt.Printf("  %6d  %-48s sonuc %.0f  skor %.3f\n", q.Count, q.Query, q.AvgResults, q.AvgTopScore)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serverCtx is cancelled when a graceful shutdown runs out of time, which
+// aborts the database, embedding and captcha calls of requests still in
+// flight.
+var serverCtx, cancelServer = context.WithCancel(context.Background())
+
+// inFlight counts the running handlers so a shutdown can wait for them
+// before closing the database pool.
+var inFlight sync.WaitGroup
+
+// requestTimeout gives every request a deadline (REQUEST_TIMEOUT) through
+// its user context. Handlers pass c.UserContext() down to the database,
+// the embedding provider and the captcha verifier, so the deadline cancels
+// that work too.
+//
+// A client that disconnects does not cancel the context: fasthttp reads
+// the whole request before calling the handler and offers no way to watch
+// the connection while it runs, so the work runs until it finishes or the
+// deadline hits. Keep REQUEST_TIMEOUT short to bound it.
+func requestTimeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		inFlight.Add(1)
+		defer inFlight.Done()
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		stop := context.AfterFunc(serverCtx, cancel)
+		defer stop()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// serverError answers a failed request. Work cut short by the request
+// deadline is reported as 504 and work aborted by a shutdown as 503
+// instead of the generic error code.
+func serverError(c *fiber.Ctx, err error, code string) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorJSON(c, fiber.StatusGatewayTimeout, fiber.Map{"error": "timeout"})
+	case errors.Is(err, context.Canceled):
+		return errorJSON(c, fiber.StatusServiceUnavailable, fiber.Map{"error": "shutting_down"})
+	}
+	return errorJSON(c, fiber.StatusInternalServerError, fiber.Map{"error": code})
+}
+
+// waitInFlight waits up to d for the running handlers to return and
+// reports whether they did.
+func waitInFlight(d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
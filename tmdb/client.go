@@ -0,0 +1,280 @@
+// Package tmdb is the TMDB v3 API client of the batch commands. One Client
+// is shared by all workers of a command: its token bucket keeps the whole
+// process under the TMDB rate limit, and requests answered with 429 or a
+// 5xx status are retried with exponential backoff, honouring Retry-After.
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-search-db/logging"
+	"movie-search-db/ratelimit"
+)
+
+const (
+	DefaultBaseURL    = "https://api.themoviedb.org/3"
+	DefaultRateLimit  = 40
+	DefaultMaxRetries = 4
+
+	// minBackoff and maxBackoff bound the wait before a retry when TMDB
+	// does not send Retry-After.
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+var (
+	// ErrNotFound is returned for 404 responses, e.g. movies deleted from
+	// TMDB.
+	ErrNotFound = errors.New("tmdb: not found")
+	// ErrUnauthorized is returned for 401 responses; the API key is wrong
+	// and no other request will succeed either.
+	ErrUnauthorized = errors.New("tmdb: unauthorized")
+	// ErrInvalidResponse is returned when a 200 response cannot be decoded.
+	// It is not retried, the same request would get the same body.
+	ErrInvalidResponse = errors.New("tmdb: invalid response")
+)
+
+// Error is a non-200 response. It matches ErrNotFound and ErrUnauthorized
+// with errors.Is.
+type Error struct {
+	StatusCode int
+	// Code and Message are the status_code and status_message of the TMDB
+	// error body, when there is one.
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("tmdb: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("tmdb: HTTP %d: %s (code %d)", e.StatusCode, e.Message, e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
+
+func (e *Error) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+type Config struct {
+	// APIKey is the API read access token, sent as bearer token.
+	APIKey string
+	// BaseURL of the API, DefaultBaseURL when empty. A local fake can stand
+	// in for TMDB, see package tmdbfake.
+	BaseURL string
+	// Timeout bounds each request attempt.
+	Timeout time.Duration
+	// RateLimit is the number of requests per second of all workers
+	// together; Burst of them may be sent at once.
+	RateLimit float64
+	Burst     int
+	// MaxRetries is the number of retries after a 429, 5xx or network
+	// error.
+	MaxRetries int
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.APIKey == "" {
+		errs = append(errs, errors.New("tmdb api key is empty"))
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, errors.New("tmdb base url must be an absolute URL"))
+		}
+	}
+	if c.RateLimit <= 0 {
+		errs = append(errs, errors.New("tmdb rate limit must be positive"))
+	}
+	if c.MaxRetries < 0 {
+		errs = append(errs, errors.New("tmdb max retries must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+type Client struct {
+	http    *http.Client
+	baseURL string
+	apiKey  string
+	retries int
+
+	limiter *ratelimit.MemoryStore
+	limit   ratelimit.Limit
+
+	mu sync.Mutex
+	// pausedUntil holds every request back after a 429 with Retry-After.
+	pausedUntil time.Time
+}
+
+func New(cfg Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	base := cfg.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	return &Client{
+		http:    &http.Client{Timeout: cfg.Timeout},
+		baseURL: strings.TrimRight(base, "/"),
+		apiKey:  cfg.APIKey,
+		retries: cfg.MaxRetries,
+		limiter: ratelimit.NewMemoryStore(),
+		limit:   ratelimit.Limit{Rate: cfg.RateLimit, Burst: max(cfg.Burst, 1)},
+	}, nil
+}
+
+// Get decodes the JSON response of path (e.g. "/movie/550") into dst.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, dst any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		retryAfter, err := c.do(ctx, u, dst)
+		if err == nil {
+			return nil
+		}
+		var apiErr *Error
+		if ctx.Err() != nil || errors.Is(err, ErrInvalidResponse) ||
+			(errors.As(err, &apiErr) && !apiErr.retryable()) || attempt >= c.retries {
+			return err
+		}
+
+		delay := backoff(attempt)
+		if retryAfter > 0 {
+			delay = retryAfter
+			c.pause(delay)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// do sends one request. For error responses it also returns the
+// Retry-After delay, 0 when there is none.
+func (c *Client) do(ctx context.Context, u string, dst any) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.CloseQuietly(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var body struct {
+			Code    int    `json:"status_code"`
+			Message string `json:"status_message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body) == nil {
+			apiErr.Code, apiErr.Message = body.Code, body.Message
+		}
+		return parseRetryAfter(resp.Header.Get("Retry-After")), apiErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		// read errors and bodies cut off by the connection are retried
+		// like any network error
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || err == io.EOF {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// wait blocks until the client may send the next request.
+func (c *Client) wait(ctx context.Context) error {
+	c.mu.Lock()
+	paused := time.Until(c.pausedUntil)
+	c.mu.Unlock()
+	if err := sleep(ctx, paused); err != nil {
+		return err
+	}
+
+	for {
+		res, err := c.limiter.Take(ctx, "tmdb", c.limit)
+		if err != nil || res.Allowed {
+			return err
+		}
+		if err := sleep(ctx, res.RetryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) pause(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until := time.Now().Add(d); until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+// backoff returns the delay before retry attempt+1: exponential from
+// minBackoff up to maxBackoff, with the upper half randomised so workers
+// that failed together do not retry together.
+func backoff(attempt int) time.Duration {
+	d := min(minBackoff<<min(attempt, 10), maxBackoff)
+	return d/2 + rand.N(d/2)
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(s, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
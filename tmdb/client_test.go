@@ -0,0 +1,232 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server answers the n-th request (from 0) with respond and counts the
+// requests.
+type server struct {
+	calls   atomic.Int32
+	respond func(n int, w http.ResponseWriter, r *http.Request)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.respond(int(s.calls.Add(1)-1), w, r)
+}
+
+func newTestClient(t *testing.T, retries int, respond func(n int, w http.ResponseWriter, r *http.Request)) (*Client, *server) {
+	t.Helper()
+	s := &server{respond: respond}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	c, err := New(Config{APIKey: "token", BaseURL: srv.URL, Timeout: 5 * time.Second, RateLimit: 1000, Burst: 100, MaxRetries: retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func writeBody(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func TestGetSendsBearerToken(t *testing.T) {
+	c, _ := newTestClient(t, 0, func(_ int, w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want Bearer token", got)
+		}
+		if r.URL.Query().Has("api_key") {
+			t.Error("api_key sent as query parameter")
+		}
+		if r.URL.Path != "/movie/550" || r.URL.Query().Get("language") != "tr-TR" {
+			t.Errorf("request = %s, want /movie/550?language=tr-TR", r.URL)
+		}
+		writeBody(w, http.StatusOK, `{"title":"Dövüş Kulübü","vote_count":30000}`)
+	})
+
+	var m Movie
+	if err := c.Get(context.Background(), "/movie/550", url.Values{"language": {"tr-TR"}}, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "Dövüş Kulübü" || m.VoteCount != 30000 {
+		t.Errorf("decoded %+v", m)
+	}
+}
+
+func TestGetTypedErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusUnauthorized, ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		c, s := newTestClient(t, 3, func(_ int, w http.ResponseWriter, _ *http.Request) {
+			writeBody(w, tt.status, `{"status_code":34,"status_message":"nope"}`)
+		})
+		err := c.Get(context.Background(), "/movie/1", nil, &Movie{})
+		if !errors.Is(err, tt.target) {
+			t.Errorf("HTTP %d: err = %v, want %v", tt.status, err, tt.target)
+		}
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.Code != 34 || apiErr.Message != "nope" {
+			t.Errorf("HTTP %d: err = %#v, want *Error with the TMDB body", tt.status, err)
+		}
+		if n := s.calls.Load(); n != 1 {
+			t.Errorf("HTTP %d: %d requests, want no retry", tt.status, n)
+		}
+	}
+}
+
+func TestGetRetriesServerErrors(t *testing.T) {
+	c, s := newTestClient(t, 2, func(n int, w http.ResponseWriter, _ *http.Request) {
+		if n == 0 {
+			writeBody(w, http.StatusServiceUnavailable, `{}`)
+			return
+		}
+		writeBody(w, http.StatusOK, `{"title":"ok"}`)
+	})
+	var m Movie
+	if err := c.Get(context.Background(), "/movie/1", nil, &m); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.calls.Load(); n != 2 || m.Title != "ok" {
+		t.Errorf("%d requests, title %q, want 2 and ok", n, m.Title)
+	}
+}
+
+func TestGetGivesUpAfterMaxRetries(t *testing.T) {
+	c, s := newTestClient(t, 1, func(_ int, w http.ResponseWriter, _ *http.Request) {
+		writeBody(w, http.StatusBadGateway, `{}`)
+	})
+	err := c.Get(context.Background(), "/movie/1", nil, &Movie{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("err = %v, want HTTP 502", err)
+	}
+	if n := s.calls.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestGetHonoursRetryAfter(t *testing.T) {
+	c, s := newTestClient(t, 1, func(n int, w http.ResponseWriter, _ *http.Request) {
+		if n == 0 {
+			w.Header().Set("Retry-After", "1")
+			writeBody(w, http.StatusTooManyRequests, `{"status_code":25}`)
+			return
+		}
+		writeBody(w, http.StatusOK, `{}`)
+	})
+	start := time.Now()
+	if err := c.Get(context.Background(), "/movie/1", nil, &Movie{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("retried after %v, want the 1s Retry-After", d)
+	}
+	if n := s.calls.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+
+	// the pause holds back every request of the client, not only the retry
+	c.pause(time.Second)
+	start = time.Now()
+	if err := c.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Errorf("wait returned after %v during a pause", d)
+	}
+}
+
+func TestGetInvalidJSONIsPermanent(t *testing.T) {
+	for _, body := range []string{`<html>maintenance</html>`, `{"title": 5}`, ``} {
+		c, s := newTestClient(t, 3, func(_ int, w http.ResponseWriter, _ *http.Request) {
+			writeBody(w, http.StatusOK, body)
+		})
+		err := c.Get(context.Background(), "/movie/1", nil, &Movie{})
+		if !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("body %q: err = %v, want ErrInvalidResponse", body, err)
+		}
+		if n := s.calls.Load(); n != 1 {
+			t.Errorf("body %q: %d requests, want no retry", body, n)
+		}
+	}
+}
+
+func TestGetStopsOnCancel(t *testing.T) {
+	c, s := newTestClient(t, 5, func(_ int, w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		writeBody(w, http.StatusTooManyRequests, `{}`)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := c.Get(ctx, "/movie/1", nil, &Movie{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 1m", future, got)
+	}
+}
+
+func TestBackoffBounds(t *testing.T) {
+	for attempt := range 20 {
+		upper := min(minBackoff<<min(attempt, 10), maxBackoff)
+		for range 50 {
+			if d := backoff(attempt); d < upper/2 || d >= upper {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v)", attempt, d, upper/2, upper)
+			}
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{APIKey: "t", RateLimit: 1}).Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	for _, c := range []Config{
+		{RateLimit: 1},
+		{APIKey: "t", RateLimit: 0},
+		{APIKey: "t", RateLimit: 1, BaseURL: "api.themoviedb.org/3"},
+		{APIKey: "t", RateLimit: 1, MaxRetries: -1},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", c)
+		}
+	}
+}
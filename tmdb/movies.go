@@ -0,0 +1,119 @@
+package tmdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxChangesWindow is the longest date range /movie/changes accepts.
+const maxChangesWindow = 14 * 24 * time.Hour
+
+// Movie is the /movie/{id} response. Credits and Keywords are only filled
+// when requested with append_to_response.
+type Movie struct {
+	Title            string  `json:"title"`
+	Overview         string  `json:"overview"`
+	Tagline          string  `json:"tagline"`
+	PosterPath       *string `json:"poster_path"`
+	ReleaseDate      string  `json:"release_date"`
+	Popularity       float64 `json:"popularity"`
+	VoteAverage      float64 `json:"vote_average"`
+	VoteCount        int     `json:"vote_count"`
+	OriginalLanguage string  `json:"original_language"`
+	Genres           []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"genres"`
+	Keywords struct {
+		Keywords []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"keywords"`
+	} `json:"keywords"`
+	Credits struct {
+		Cast []struct {
+			Name      string `json:"name"`
+			Character string `json:"character"`
+			Order     int    `json:"order"`
+		} `json:"cast"`
+		Crew []struct {
+			Name string `json:"name"`
+			Job  string `json:"job"`
+		} `json:"crew"`
+	} `json:"credits"`
+}
+
+// Movie returns the details of a movie in language (e.g. "tr-TR") with
+// the appended responses, e.g. "credits" and "keywords".
+func (c *Client) Movie(ctx context.Context, tmdbID int, language string, appendTo ...string) (*Movie, error) {
+	query := url.Values{"language": {language}}
+	if len(appendTo) > 0 {
+		query.Set("append_to_response", strings.Join(appendTo, ","))
+	}
+	var res Movie
+	if err := c.Get(ctx, "/movie/"+strconv.Itoa(tmdbID), query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// idPage is one page of /movie/changes, /movie/now_playing or /movie/popular.
+type idPage struct {
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
+	Results    []struct {
+		ID    int  `json:"id"`
+		Adult bool `json:"adult"`
+	} `json:"results"`
+}
+
+// IDs pages through a movie list endpoint such as /movie/popular and
+// returns the ids of the non-adult movies. maxPages <= 0 reads every page.
+func (c *Client) IDs(ctx context.Context, path string, query url.Values, maxPages int) ([]int, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	var ids []int
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var res idPage
+		if err := c.Get(ctx, path, query, &res); err != nil {
+			return ids, fmt.Errorf("%s page %d: %w", path, page, err)
+		}
+		for _, r := range res.Results {
+			if !r.Adult {
+				ids = append(ids, r.ID)
+			}
+		}
+		if page >= res.TotalPages {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// Changes returns the movies TMDB reports as changed between from and to.
+// /movie/changes accepts at most 14 days per request, longer ranges are
+// split.
+func (c *Client) Changes(ctx context.Context, from, to time.Time) ([]int, error) {
+	var ids []int
+	for start := from; start.Before(to); start = start.Add(maxChangesWindow) {
+		end := start.Add(maxChangesWindow)
+		if end.After(to) {
+			end = to
+		}
+		page, err := c.IDs(ctx, "/movie/changes", url.Values{
+			"start_date": {start.UTC().Format(time.DateOnly)},
+			"end_date":   {end.UTC().Format(time.DateOnly)},
+		}, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, page...)
+	}
+	return ids, nil
+}
@@ -0,0 +1,232 @@
+// Package tmdbfake serves the part of the TMDB v3 API used by the sync
+// commands from an in-memory movie list: movie details (Turkish or English,
+// with credits and keywords), /movie/changes, /movie/now_playing and
+// /movie/popular. Point TMDB_BASE_URL at it to run `moviedb sync` offline.
+package tmdbfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pageSize = 20
+
+// Movie is one movie of the fake catalog.
+type Movie struct {
+	ID               int       `json:"id"`
+	Title            string    `json:"title"`
+	Tagline          string    `json:"tagline"`
+	Overview         string    `json:"overview"`
+	TitleTR          string    `json:"title_tr"`
+	TaglineTR        string    `json:"tagline_tr"`
+	OverviewTR       string    `json:"overview_tr"`
+	PosterPath       string    `json:"poster_path"`
+	ReleaseDate      string    `json:"release_date"`
+	Popularity       float64   `json:"popularity"`
+	VoteAverage      float64   `json:"vote_average"`
+	VoteCount        int       `json:"vote_count"`
+	OriginalLanguage string    `json:"original_language"`
+	Genres           []string  `json:"genres"`
+	Keywords         []string  `json:"keywords"`
+	Cast             []string  `json:"cast"`
+	Director         string    `json:"director"`
+	Adult            bool      `json:"adult"`
+	ChangedAt        time.Time `json:"changed_at"`
+	NowPlaying       bool      `json:"now_playing"`
+	Popular          bool      `json:"popular"`
+}
+
+// Server is an http.Handler for the fake API. When APIKey is set requests
+// must carry it as api_key parameter or bearer token.
+type Server struct {
+	Movies []Movie
+	APIKey string
+}
+
+// Load reads a JSON array of movies.
+func Load(path string) ([]Movie, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var movies []Movie
+	if err := json.Unmarshal(raw, &movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, 3, "Method not allowed.")
+		return
+	}
+	if s.APIKey != "" && r.URL.Query().Get("api_key") != s.APIKey &&
+		r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+		writeError(w, http.StatusUnauthorized, 7, "Invalid API key: You must be granted a valid key.")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch path {
+	case "/movie/changes":
+		s.changes(w, r)
+	case "/movie/now_playing":
+		s.list(w, r, func(m Movie) bool { return m.NowPlaying })
+	case "/movie/popular":
+		s.list(w, r, func(m Movie) bool { return m.Popular })
+	default:
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/movie/"))
+		if !strings.HasPrefix(path, "/movie/") || err != nil {
+			writeError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+			return
+		}
+		s.details(w, r, id)
+	}
+}
+
+func (s *Server) changes(w http.ResponseWriter, r *http.Request) {
+	from, err := time.Parse(time.DateOnly, r.URL.Query().Get("start_date"))
+	if err != nil {
+		from = time.Now().Add(-24 * time.Hour)
+	}
+	to, err := time.Parse(time.DateOnly, r.URL.Query().Get("end_date"))
+	if err != nil {
+		to = time.Now()
+	}
+	to = to.Add(24 * time.Hour)
+
+	var ids []map[string]any
+	for _, m := range s.Movies {
+		if !m.ChangedAt.Before(from) && m.ChangedAt.Before(to) {
+			ids = append(ids, map[string]any{"id": m.ID, "adult": m.Adult})
+		}
+	}
+	writePage(w, r, ids)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, keep func(Movie) bool) {
+	var movies []Movie
+	for _, m := range s.Movies {
+		if keep(m) {
+			movies = append(movies, m)
+		}
+	}
+	slices.SortFunc(movies, func(a, b Movie) int {
+		switch {
+		case a.Popularity > b.Popularity:
+			return -1
+		case a.Popularity < b.Popularity:
+			return 1
+		}
+		return a.ID - b.ID
+	})
+
+	tr := r.URL.Query().Get("language") == "tr-TR"
+	results := make([]map[string]any, len(movies))
+	for i, m := range movies {
+		results[i] = summary(m, tr)
+	}
+	writePage(w, r, results)
+}
+
+func (s *Server) details(w http.ResponseWriter, r *http.Request, id int) {
+	i := slices.IndexFunc(s.Movies, func(m Movie) bool { return m.ID == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	m := s.Movies[i]
+	q := r.URL.Query()
+
+	body := summary(m, q.Get("language") == "tr-TR")
+	genres := make([]map[string]any, len(m.Genres))
+	for i, g := range m.Genres {
+		genres[i] = map[string]any{"id": i + 1, "name": g}
+	}
+	body["genres"] = genres
+
+	appended := strings.Split(q.Get("append_to_response"), ",")
+	if slices.Contains(appended, "credits") {
+		cast := make([]map[string]any, len(m.Cast))
+		for i, name := range m.Cast {
+			cast[i] = map[string]any{"name": name, "character": "", "order": i}
+		}
+		crew := []map[string]any{}
+		if m.Director != "" {
+			crew = append(crew, map[string]any{"name": m.Director, "job": "Director"})
+		}
+		body["credits"] = map[string]any{"cast": cast, "crew": crew}
+	}
+	if slices.Contains(appended, "keywords") {
+		keywords := make([]map[string]any, len(m.Keywords))
+		for i, k := range m.Keywords {
+			keywords[i] = map[string]any{"id": i + 1, "name": k}
+		}
+		body["keywords"] = map[string]any{"keywords": keywords}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// summary returns the fields shared by list results and details. Turkish
+// texts fall back to the English ones like TMDB does for the title.
+func summary(m Movie, tr bool) map[string]any {
+	title, tagline, overview := m.Title, m.Tagline, m.Overview
+	if tr {
+		title, tagline, overview = m.TitleTR, m.TaglineTR, m.OverviewTR
+		if title == "" {
+			title = m.Title
+		}
+	}
+	var poster any
+	if m.PosterPath != "" {
+		poster = m.PosterPath
+	}
+	return map[string]any{
+		"id":                m.ID,
+		"title":             title,
+		"tagline":           tagline,
+		"overview":          overview,
+		"poster_path":       poster,
+		"release_date":      m.ReleaseDate,
+		"popularity":        m.Popularity,
+		"vote_average":      m.VoteAverage,
+		"vote_count":        m.VoteCount,
+		"original_language": m.OriginalLanguage,
+		"adult":             m.Adult,
+	}
+}
+
+func writePage(w http.ResponseWriter, r *http.Request, results []map[string]any) {
+	if results == nil {
+		results = []map[string]any{}
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	total := max(1, (len(results)+pageSize-1)/pageSize)
+	from := min(len(results), (page-1)*pageSize)
+	to := min(len(results), from+pageSize)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"page":          page,
+		"results":       results[from:to],
+		"total_pages":   total,
+		"total_results": len(results),
+	})
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	writeJSON(w, status, map[string]any{"success": false, "status_code": code, "status_message": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}